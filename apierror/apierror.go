@@ -0,0 +1,180 @@
+// Package apierror defines the errors handlers return to clients and renders
+// them as RFC 7807 problem details:
+//
+//	HTTP/1.1 404 Not Found
+//	Content-Type: application/problem+json
+//
+//	{
+//	  "type": "urn:collecthub:problem:not_found",
+//	  "title": "Resource not found",
+//	  "status": 404,
+//	  "detail": "book not found",
+//	  "instance": "/api/books/66a1...",
+//	  "code": "not_found",
+//	  "request_id": "4b1e..."
+//	}
+//
+// Clients branch on code (or type, which carries the same value); detail is
+// for humans and may change.
+package apierror
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+
+	"github.com/kashyapprajapat/collecthub_api/validation"
+)
+
+// ContentType is the media type of problem documents
+const ContentType = "application/problem+json"
+
+// typePrefix turns a code into the problem type URI
+const typePrefix = "urn:collecthub:problem:"
+
+// Error is an error meant for the client. Handlers return it and Handler
+// renders it.
+type Error struct {
+	Status     int                    // HTTP status
+	Code       string                 // Machine-readable, one of the Code constants
+	Detail     string                 // Explanation of this occurrence
+	Extensions map[string]interface{} // Extra members of the problem document
+	Err        error                  // Underlying cause, logged but never sent
+}
+
+// New returns an error with the given status, code and detail
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// With adds a member to the problem document
+func (e *Error) With(key string, value interface{}) *Error {
+	if e.Extensions == nil {
+		e.Extensions = map[string]interface{}{}
+	}
+	e.Extensions[key] = value
+	return e
+}
+
+// Wrap records the cause of a server-side failure for the logs
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+func BadRequest(code, detail string) *Error {
+	return New(fiber.StatusBadRequest, code, detail)
+}
+
+func Unauthorized(code, detail string) *Error {
+	return New(fiber.StatusUnauthorized, code, detail)
+}
+
+func Forbidden(code, detail string) *Error {
+	return New(fiber.StatusForbidden, code, detail)
+}
+
+func NotFound(detail string) *Error {
+	return New(fiber.StatusNotFound, CodeNotFound, detail)
+}
+
+func Conflict(code, detail string) *Error {
+	return New(fiber.StatusConflict, code, detail)
+}
+
+func TooManyRequests(detail string) *Error {
+	return New(fiber.StatusTooManyRequests, CodeRateLimited, detail)
+}
+
+func Internal(detail string) *Error {
+	return New(fiber.StatusInternalServerError, CodeInternal, detail)
+}
+
+// InvalidBody reports a request body that couldn't be parsed
+func InvalidBody() *Error {
+	return BadRequest(CodeInvalidBody, "request body must be valid JSON")
+}
+
+// Validation reports invalid fields, listed under "errors" so clients can
+// show each message next to the matching form input
+func Validation(errs validation.Errors) *Error {
+	return New(fiber.StatusUnprocessableEntity, CodeValidationFailed, "one or more fields are invalid").
+		With("errors", errs)
+}
+
+// Handler is the Fiber ErrorHandler rendering every error returned by a
+// handler or middleware as a problem document. Errors that aren't an *Error
+// become a 500 without exposing their message.
+func Handler(c *fiber.Ctx, err error) error {
+	var e *Error
+	if !errors.As(err, &e) {
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			e = New(fe.Code, codeForStatus(fe.Code), fe.Message)
+		} else {
+			e = Internal("internal server error").Wrap(err)
+		}
+	}
+
+	if e.Status >= fiber.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Method(), c.Path(), e)
+	}
+
+	problem := fiber.Map{}
+	for key, value := range e.Extensions {
+		problem[key] = value
+	}
+	problem["type"] = typePrefix + e.Code
+	problem["title"] = title(e)
+	problem["status"] = e.Status
+	problem["detail"] = e.Detail
+	problem["instance"] = c.Path()
+	problem["code"] = e.Code
+	if id, ok := c.Locals(requestid.ConfigDefault.ContextKey).(string); ok && id != "" {
+		problem["request_id"] = id
+	}
+
+	return c.Status(e.Status).JSON(problem, ContentType)
+}
+
+func title(e *Error) string {
+	if t, ok := titles[e.Code]; ok {
+		return t
+	}
+	return http.StatusText(e.Status)
+}
+
+// codeForStatus picks a code for errors raised by Fiber itself, such as
+// unknown routes or oversized bodies
+func codeForStatus(status int) string {
+	switch status {
+	case fiber.StatusBadRequest:
+		return CodeBadRequest
+	case fiber.StatusNotFound:
+		return CodeNotFound
+	case fiber.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case fiber.StatusRequestEntityTooLarge:
+		return CodeBodyTooLarge
+	case fiber.StatusTooManyRequests:
+		return CodeRateLimited
+	}
+	if status >= fiber.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
@@ -0,0 +1,102 @@
+package apierror
+
+// Error codes. They are part of the API: add new ones freely, but never
+// rename or reuse one.
+const (
+	// Requests
+	CodeBadRequest           = "bad_request"
+	CodeInvalidBody          = "invalid_body"
+	CodeInvalidID            = "invalid_id"
+	CodeInvalidParameter     = "invalid_parameter"
+	CodeMissingField         = "missing_field"
+	CodeInvalidField         = "invalid_field"
+	CodeValidationFailed     = "validation_failed"
+	CodeNoChanges            = "no_changes"
+	CodeInvalidPatch         = "invalid_patch"
+	CodePatchTestFailed      = "patch_test_failed"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeEditConflict         = "edit_conflict"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal_error"
+
+	// Authentication and authorization
+	CodeUnauthenticated       = "unauthenticated"
+	CodeInvalidToken          = "invalid_token"
+	CodeInvalidCredentials    = "invalid_credentials"
+	CodeInvalidAPIKey         = "invalid_api_key"
+	CodeAccountDisabled       = "account_disabled"
+	CodeForbidden             = "forbidden"
+	CodeInsufficientScope     = "insufficient_scope"
+	CodeAPIKeyNotAllowed      = "api_key_not_allowed"
+	CodeEmailNotVerified      = "email_not_verified"
+	CodeIdentityProviderError = "identity_provider_error"
+	CodeIdentityNotLinked     = "identity_not_linked"
+	CodeIdentityAlreadyLinked = "identity_already_linked"
+	CodeReauthRequired        = "reauthentication_required"
+
+	// Accounts
+	CodeEmailTaken           = "email_taken"
+	CodeInvalidEmail         = "invalid_email"
+	CodeEmailAlreadyVerified = "email_already_verified"
+	CodeCannotModifySelf     = "cannot_modify_self"
+	CodeInvalidScope         = "invalid_scope"
+	CodeAPIKeyLimitReached   = "api_key_limit_reached"
+
+	// Two-factor authentication
+	CodeInvalidTwoFactorCode    = "invalid_two_factor_code"
+	CodeTwoFactorAlreadyEnabled = "two_factor_already_enabled"
+	CodeTwoFactorNotEnabled     = "two_factor_not_enabled"
+	CodeTwoFactorSetupRequired  = "two_factor_setup_required"
+)
+
+// titles are the short summaries shared by every occurrence of a code
+var titles = map[string]string{
+	CodeBadRequest:           "Bad request",
+	CodeInvalidBody:          "Invalid request body",
+	CodeInvalidID:            "Invalid ID",
+	CodeInvalidParameter:     "Invalid query parameter",
+	CodeMissingField:         "Missing required field",
+	CodeInvalidField:         "Invalid field",
+	CodeValidationFailed:     "Validation failed",
+	CodeNoChanges:            "Nothing to update",
+	CodeInvalidPatch:         "Invalid patch",
+	CodePatchTestFailed:      "Patch test failed",
+	CodePreconditionFailed:   "Precondition failed",
+	CodeEditConflict:         "Changed by another request",
+	CodeUnsupportedMediaType: "Unsupported media type",
+	CodeNotFound:             "Resource not found",
+	CodeMethodNotAllowed:     "Method not allowed",
+	CodeBodyTooLarge:         "Request body too large",
+	CodeRateLimited:          "Too many requests",
+	CodeInternal:             "Internal server error",
+
+	CodeUnauthenticated:       "Authentication required",
+	CodeInvalidToken:          "Invalid or expired token",
+	CodeInvalidCredentials:    "Invalid credentials",
+	CodeInvalidAPIKey:         "Invalid or expired API key",
+	CodeAccountDisabled:       "Account disabled",
+	CodeForbidden:             "Forbidden",
+	CodeInsufficientScope:     "Insufficient API key scope",
+	CodeAPIKeyNotAllowed:      "API keys not allowed",
+	CodeEmailNotVerified:      "Email not verified",
+	CodeIdentityProviderError: "Identity provider error",
+	CodeIdentityNotLinked:     "External identity not linked",
+	CodeIdentityAlreadyLinked: "External identity already linked",
+	CodeReauthRequired:        "Recent sign-in required",
+
+	CodeEmailTaken:           "Email already in use",
+	CodeInvalidEmail:         "Invalid email address",
+	CodeEmailAlreadyVerified: "Email already verified",
+	CodeCannotModifySelf:     "Cannot modify own account",
+	CodeInvalidScope:         "Invalid API key scope",
+	CodeAPIKeyLimitReached:   "API key limit reached",
+
+	CodeInvalidTwoFactorCode:    "Invalid two-factor code",
+	CodeTwoFactorAlreadyEnabled: "Two-factor authentication already enabled",
+	CodeTwoFactorNotEnabled:     "Two-factor authentication not enabled",
+	CodeTwoFactorSetupRequired:  "Two-factor setup required",
+}
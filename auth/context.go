@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	localsUserID = "auth_user_id"
+	localsClaims = "auth_claims"
+)
+
+// SetIdentity stores the authenticated identity on the request context
+func SetIdentity(c *fiber.Ctx, userID primitive.ObjectID, claims *Claims) {
+	c.Locals(localsUserID, userID)
+	c.Locals(localsClaims, claims)
+}
+
+// CurrentUserID returns the authenticated user's ID, or a zero ObjectID
+// when the request did not pass through the auth middleware
+func CurrentUserID(c *fiber.Ctx) primitive.ObjectID {
+	userID, _ := c.Locals(localsUserID).(primitive.ObjectID)
+	return userID
+}
+
+// CurrentClaims returns the verified token claims for the request
+func CurrentClaims(c *fiber.Ctx) *Claims {
+	claims, _ := c.Locals(localsClaims).(*Claims)
+	return claims
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher turns passwords into self-describing encoded hashes that
+// carry their algorithm and parameters
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify checks a password against a hash of this hasher's algorithm,
+	// using the parameters stored in the hash
+	Verify(password, encoded string) bool
+	// UpToDate reports whether encoded uses this hasher's algorithm and
+	// current parameters
+	UpToDate(encoded string) bool
+}
+
+// BcryptHasher stores hashes in bcrypt's own $2b$<cost>$ format
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h BcryptHasher) Verify(password, encoded string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+func (h BcryptHasher) UpToDate(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost == h.Cost
+}
+
+// Argon2idHasher stores hashes in the PHC string format:
+// $argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Verify(password, encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false
+	}
+	actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(actual, key) == 1
+}
+
+func (h Argon2idHasher) UpToDate(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false
+	}
+	return params.Memory == h.Memory &&
+		params.Iterations == h.Iterations &&
+		params.Parallelism == h.Parallelism &&
+		uint32(len(salt)) == h.SaltLength &&
+		uint32(len(key)) == h.KeyLength
+}
+
+func decodeArgon2id(encoded string) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return params, nil, nil, fmt.Errorf("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %v", err)
+	}
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// passwordHasher hashes new passwords. Defaults match what every existing
+// hash was created with.
+var passwordHasher PasswordHasher = BcryptHasher{Cost: 14}
+
+// HashPassword hashes a password with the configured algorithm
+func HashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
+// VerifyPassword checks a password against a hash of any supported
+// algorithm, so hashes made before a configuration change keep working
+func VerifyPassword(password, encoded string) bool {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return Argon2idHasher{}.Verify(password, encoded)
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return BcryptHasher{}.Verify(password, encoded)
+	}
+	return false
+}
+
+// PasswordNeedsRehash reports whether a hash was made with a different
+// algorithm or parameters than the ones configured now
+func PasswordNeedsRehash(encoded string) bool {
+	return !passwordHasher.UpToDate(encoded)
+}
+
+// InitPasswords loads the hashing algorithm and password policy from
+// environment variables.
+//
+// PASSWORD_HASH_ALGORITHM selects bcrypt (default) or argon2id. bcrypt uses
+// BCRYPT_COST (default 14); argon2id uses ARGON2ID_MEMORY_KIB (default 65536),
+// ARGON2ID_ITERATIONS (default 3) and ARGON2ID_PARALLELISM (default 2).
+// Existing hashes are upgraded the next time their owner logs in.
+func InitPasswords() error {
+	switch strings.ToLower(os.Getenv("PASSWORD_HASH_ALGORITHM")) {
+	case "", "bcrypt":
+		cost, err := intFromEnv("BCRYPT_COST", 14)
+		if err != nil {
+			return err
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		passwordHasher = BcryptHasher{Cost: cost}
+	case "argon2id":
+		memory, err := intFromEnv("ARGON2ID_MEMORY_KIB", 64*1024)
+		if err != nil {
+			return err
+		}
+		iterations, err := intFromEnv("ARGON2ID_ITERATIONS", 3)
+		if err != nil {
+			return err
+		}
+		parallelism, err := intFromEnv("ARGON2ID_PARALLELISM", 2)
+		if err != nil {
+			return err
+		}
+		if memory < 8*1024 || iterations < 1 || parallelism < 1 || parallelism > 255 {
+			return fmt.Errorf("argon2id needs at least 8192 KiB of memory, 1 iteration and 1 to 255 threads")
+		}
+		passwordHasher = Argon2idHasher{
+			Memory:      uint32(memory),
+			Iterations:  uint32(iterations),
+			Parallelism: uint8(parallelism),
+			SaltLength:  16,
+			KeyLength:   32,
+		}
+	default:
+		return fmt.Errorf("unsupported PASSWORD_HASH_ALGORITHM %q", os.Getenv("PASSWORD_HASH_ALGORITHM"))
+	}
+
+	return initPasswordPolicy()
+}
+
+func intFromEnv(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return n, nil
+}
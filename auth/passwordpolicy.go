@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// bcrypt ignores everything past the first 72 bytes of a password
+const bcryptMaxPasswordBytes = 72
+
+// PasswordPolicy decides which new passwords are acceptable
+type PasswordPolicy struct {
+	MinLength int // Characters
+	MaxLength int // Characters
+	breached  map[string]struct{}
+}
+
+var passwordPolicy = PasswordPolicy{MinLength: 8, MaxLength: 128}
+
+// CheckPasswordPolicy returns an error, worded for the end user, when a new
+// password is not acceptable. Existing passwords are never re-checked.
+func CheckPasswordPolicy(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < passwordPolicy.MinLength {
+		return fmt.Errorf("password must be at least %d characters", passwordPolicy.MinLength)
+	}
+	if length > passwordPolicy.MaxLength {
+		return fmt.Errorf("password must be at most %d characters", passwordPolicy.MaxLength)
+	}
+	if _, ok := passwordHasher.(BcryptHasher); ok && len(password) > bcryptMaxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes", bcryptMaxPasswordBytes)
+	}
+	if _, found := passwordPolicy.breached[sha1Hex(password)]; found {
+		return errors.New("password appears in a list of breached passwords, choose a different one")
+	}
+	return nil
+}
+
+// initPasswordPolicy reads PASSWORD_MIN_LENGTH (default 8),
+// PASSWORD_MAX_LENGTH (default 128) and PASSWORD_BREACHED_LIST_FILE.
+//
+// The breached list has one entry per line: either a plain password or the
+// uppercase or lowercase SHA-1 hex of one, optionally followed by ":<count>"
+// as in the Have I Been Pwned downloads. Blank lines and lines starting with
+// # are skipped.
+func initPasswordPolicy() error {
+	minLength, err := intFromEnv("PASSWORD_MIN_LENGTH", 8)
+	if err != nil {
+		return err
+	}
+	maxLength, err := intFromEnv("PASSWORD_MAX_LENGTH", 128)
+	if err != nil {
+		return err
+	}
+	if minLength < 1 || maxLength < minLength {
+		return errors.New("PASSWORD_MIN_LENGTH must be at least 1 and no greater than PASSWORD_MAX_LENGTH")
+	}
+
+	policy := PasswordPolicy{MinLength: minLength, MaxLength: maxLength}
+	if path := os.Getenv("PASSWORD_BREACHED_LIST_FILE"); path != "" {
+		if policy.breached, err = loadBreachedList(path); err != nil {
+			return err
+		}
+	}
+
+	passwordPolicy = policy
+	return nil
+}
+
+func loadBreachedList(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading breached password list: %v", err)
+	}
+	defer f.Close()
+
+	breached := map[string]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		breached[sha1Hex(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading breached password list: %v", err)
+	}
+
+	return breached, nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
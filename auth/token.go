@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	issuer = "collecthub_api"
+
+	// Audiences keep the different kinds of signed tokens from being
+	// accepted in place of each other
+	audienceAccess    = "access"
+	audienceChallenge = "2fa_challenge"
+
+	challengeTTL = 5 * time.Minute
+)
+
+var (
+	signingMethod jwt.SigningMethod
+	signingKey    interface{}
+	verifyKey     interface{}
+	accessTTL     time.Duration
+	refreshTTL    time.Duration
+)
+
+// Claims are the claims carried by a CollectHub access token
+type Claims struct {
+	Email         string           `json:"email"`
+	EmailVerified bool             `json:"email_verified"`
+	Role          string           `json:"role"`
+	SessionID     string           `json:"sid,omitempty"`       // Refresh token family the token was issued for
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"` // When the holder last signed in, kept across refreshes
+	jwt.RegisteredClaims
+}
+
+// Identity is what an access token asserts about its holder
+type Identity struct {
+	UserID        primitive.ObjectID
+	Email         string
+	EmailVerified bool
+	Role          string
+	SessionID     string
+	AuthTime      time.Time
+}
+
+// Init loads the token configuration from environment variables.
+//
+// JWT_ALGORITHM selects HS256 (default) or RS256. HS256 needs JWT_SECRET,
+// RS256 needs JWT_PRIVATE_KEY_FILE and optionally JWT_PUBLIC_KEY_FILE
+// (derived from the private key when not set). JWT_ACCESS_TTL and
+// REFRESH_TOKEN_TTL are Go durations and default to 15 minutes and 30 days.
+func Init() error {
+	var err error
+	if accessTTL, err = durationFromEnv("JWT_ACCESS_TTL", 15*time.Minute); err != nil {
+		return err
+	}
+	if refreshTTL, err = durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour); err != nil {
+		return err
+	}
+
+	switch strings.ToUpper(os.Getenv("JWT_ALGORITHM")) {
+	case "", "HS256":
+		secret := os.Getenv("JWT_SECRET")
+		if len(secret) < 32 {
+			return errors.New("JWT_SECRET must be set to at least 32 characters")
+		}
+		signingMethod = jwt.SigningMethodHS256
+		signingKey = []byte(secret)
+		verifyKey = []byte(secret)
+	case "RS256":
+		privateKey, err := loadRSAPrivateKey(os.Getenv("JWT_PRIVATE_KEY_FILE"))
+		if err != nil {
+			return err
+		}
+		publicKey := &privateKey.PublicKey
+		if path := os.Getenv("JWT_PUBLIC_KEY_FILE"); path != "" {
+			if publicKey, err = loadRSAPublicKey(path); err != nil {
+				return err
+			}
+		}
+		signingMethod = jwt.SigningMethodRS256
+		signingKey = privateKey
+		verifyKey = publicKey
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM %q", os.Getenv("JWT_ALGORITHM"))
+	}
+
+	return nil
+}
+
+// IssueAccessToken signs a new access token for the given identity
+func IssueAccessToken(id Identity) (string, time.Time, error) {
+	if signingMethod == nil {
+		return "", time.Time{}, errors.New("token signer not initialized")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(accessTTL)
+	claims := Claims{
+		Email:         id.Email,
+		EmailVerified: id.EmailVerified,
+		Role:          id.Role,
+		SessionID:     id.SessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audienceAccess},
+			Subject:   id.UserID.Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        primitive.NewObjectID().Hex(),
+		},
+	}
+	if !id.AuthTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(id.AuthTime)
+	}
+
+	signed, err := jwt.NewWithClaims(signingMethod, claims).SignedString(signingKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expiresAt, nil
+}
+
+// ParseAccessToken verifies the signature and expiry of an access token
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if err := parse(tokenString, audienceAccess, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// IssueChallengeToken signs a short-lived token proving the password step
+// of a two-factor login succeeded. It is not accepted as an access token.
+func IssueChallengeToken(userID primitive.ObjectID) (string, time.Time, error) {
+	if signingMethod == nil {
+		return "", time.Time{}, errors.New("token signer not initialized")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(challengeTTL)
+	claims := jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Audience:  jwt.ClaimStrings{audienceChallenge},
+		Subject:   userID.Hex(),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		ID:        primitive.NewObjectID().Hex(),
+	}
+
+	signed, err := jwt.NewWithClaims(signingMethod, claims).SignedString(signingKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expiresAt, nil
+}
+
+// ParseChallengeToken verifies a two-factor challenge token and returns the
+// user it was issued for
+func ParseChallengeToken(tokenString string) (primitive.ObjectID, error) {
+	claims := &jwt.RegisteredClaims{}
+	if err := parse(tokenString, audienceChallenge, claims); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return primitive.ObjectIDFromHex(claims.Subject)
+}
+
+func parse(tokenString, audience string, claims jwt.Claims) error {
+	if signingMethod == nil {
+		return errors.New("token signer not initialized")
+	}
+
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		func(*jwt.Token) (interface{}, error) { return verifyKey, nil },
+		jwt.WithValidMethods([]string{signingMethod.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return err
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil {
+		return err
+	}
+	if _, err := primitive.ObjectIDFromHex(subject); err != nil {
+		return errors.New("invalid token subject")
+	}
+
+	return nil
+}
+
+// RefreshTTL is how long a refresh token stays valid after it is issued
+func RefreshTTL() time.Duration {
+	return refreshTTL
+}
+
+func durationFromEnv(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return d, nil
+}
+
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	if path == "" {
+		return nil, errors.New("JWT_PRIVATE_KEY_FILE is required for RS256")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading private key: %v", err)
+	}
+	return jwt.ParseRSAPrivateKeyFromPEM(data)
+}
+
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading public key: %v", err)
+	}
+	return jwt.ParseRSAPublicKeyFromPEM(data)
+}
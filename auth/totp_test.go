@@ -0,0 +1,87 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kashyapprajapat/collecthub_api/auth"
+)
+
+// "12345678901234567890", the RFC 6238 SHA1 test key, in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 Appendix B, SHA1. The RFC lists eight digits, six are the
+	// last six of those.
+	for _, tt := range []struct {
+		unix int64
+		step int64
+		want string
+	}{
+		{59, 0x1, "287082"},
+		{1111111109, 0x23523EC, "081804"},
+		{1111111111, 0x23523ED, "050471"},
+		{1234567890, 0x273EF07, "005924"},
+		{2000000000, 0x3F940AA, "279037"},
+		{20000000000, 0x27BC86AA, "353130"},
+	} {
+		step := auth.TOTPStep(time.Unix(tt.unix, 0))
+		if step != tt.step {
+			t.Errorf("TOTPStep(%d) = %#x, want %#x", tt.unix, step, tt.step)
+		}
+		got, err := auth.TOTPCode(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("TOTPCode at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestTOTPCodeAcceptsLowercaseSecret(t *testing.T) {
+	got, err := auth.TOTPCode(strings.ToLower(rfcSecret), 1)
+	if err != nil || got != "287082" {
+		t.Fatalf("TOTPCode = %s, %v, want 287082", got, err)
+	}
+	if _, err := auth.TOTPCode("not base32!", 1); err == nil {
+		t.Fatal("TOTPCode with an invalid secret: want an error")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := auth.TOTPStep(now)
+
+	code := func(step int64) string {
+		c, err := auth.TOTPCode(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// One step of drift either way is allowed
+	for _, offset := range []int64{-1, 0, 1} {
+		step, ok := auth.ValidateTOTP(rfcSecret, code(current+offset), now)
+		if !ok || step != current+offset {
+			t.Errorf("offset %d: ValidateTOTP = %d, %v, want %d, true", offset, step, ok, current+offset)
+		}
+	}
+	for _, offset := range []int64{-2, 2} {
+		if _, ok := auth.ValidateTOTP(rfcSecret, code(current+offset), now); ok {
+			t.Errorf("offset %d: ValidateTOTP accepted the code", offset)
+		}
+	}
+
+	// Spaces are ignored, the length is not
+	if _, ok := auth.ValidateTOTP(rfcSecret, " 050 471 ", now); !ok {
+		t.Error("ValidateTOTP rejected a code with spaces")
+	}
+	for _, c := range []string{"", "05047", "0504711", "abcdef"} {
+		if _, ok := auth.ValidateTOTP(rfcSecret, c, now); ok {
+			t.Errorf("ValidateTOTP accepted %q", c)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+)
+
+const (
+	defaultUsersPageSize = 20
+	maxUsersPageSize     = 100
+)
+
+// AdminHandler serves the administrator-only user management routes
+type AdminHandler struct {
+	users    repository.UserRepository
+	sessions repository.SessionRepository
+	audit    repository.AuditLog
+}
+
+func NewAdminHandler(users repository.UserRepository, sessions repository.SessionRepository, audit repository.AuditLog) *AdminHandler {
+	return &AdminHandler{users: users, sessions: sessions, audit: audit}
+}
+
+// GetUsers lists accounts for administrators. Supports ?page=, ?limit= and a
+// case-insensitive ?q= search over name and email.
+func (h *AdminHandler) GetUsers(c *fiber.Ctx) error {
+	page, limit, msg := pageParams(c, defaultUsersPageSize, maxUsersPageSize)
+	if msg != "" {
+		return apierror.BadRequest(apierror.CodeInvalidParameter, msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	users, total, err := h.users.List(ctx, strings.TrimSpace(c.Query("q")), page, limit)
+	if err != nil {
+		return apierror.Internal("failed to fetch users").Wrap(err)
+	}
+
+	// Remove passwords from response (extra safety)
+	safeUsers := make([]fiber.Map, 0, len(users))
+	for _, user := range users {
+		profile := userProfile(user)
+		profile["disabled"] = user.Disabled
+		safeUsers = append(safeUsers, profile)
+	}
+
+	return c.JSON(fiber.Map{
+		"users": safeUsers,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// CurrentRole looks up the role an account has now, for RequireRole.
+// Disabled and deleted accounts have none.
+func (h *AdminHandler) CurrentRole(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	user, err := h.users.FindByID(ctx, userID)
+	if err == repository.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.Disabled {
+		return "", nil
+	}
+	return user.EffectiveRole(), nil
+}
+
+// SetUserStatus disables or re-enables an account. Disabling also revokes
+// every session the user holds.
+func (h *AdminHandler) SetUserStatus(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidID, "invalid user ID")
+	}
+
+	var req models.UpdateUserStatusRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+	if req.Disabled == nil {
+		return apierror.BadRequest(apierror.CodeMissingField, "disabled is required")
+	}
+
+	if objID == auth.CurrentUserID(c) {
+		return apierror.BadRequest(apierror.CodeCannotModifySelf, "you cannot change the status of your own account")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Read the previous value in the same operation for the audit log
+	before, err := h.users.Update(ctx, objID, map[string]interface{}{"disabled": *req.Disabled})
+	if err == repository.ErrNotFound {
+		return apierror.NotFound("user not found")
+	}
+	if err != nil {
+		return apierror.Internal("failed to update user").Wrap(err)
+	}
+
+	recordAuditTo(c, h.audit, models.AuditEvent{
+		Action:     models.AuditUserStatusChanged,
+		UserID:     &objID,
+		TargetType: "user",
+		TargetID:   &objID,
+		Before:     bson.M{"disabled": before.Disabled},
+		After:      bson.M{"disabled": *req.Disabled},
+	})
+
+	if *req.Disabled {
+		if _, err := h.sessions.RevokeAll(ctx, objID); err != nil {
+			log.Printf("Failed to revoke sessions of disabled user %s: %v", objID.Hex(), err)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "user status updated successfully",
+		"disabled": *req.Disabled,
+	})
+}
+
+// SetUserRole changes an account's role and revokes every session the user
+// holds, so their next access token carries the new role
+func (h *AdminHandler) SetUserRole(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidID, "invalid user ID")
+	}
+
+	var req models.UpdateUserRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+	if req.Role != models.RoleUser && req.Role != models.RoleAdmin {
+		return apierror.BadRequest(apierror.CodeInvalidField, "role must be one of: user, admin")
+	}
+
+	if objID == auth.CurrentUserID(c) {
+		return apierror.BadRequest(apierror.CodeCannotModifySelf, "you cannot change the role of your own account")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	before, err := h.users.Update(ctx, objID, map[string]interface{}{"role": req.Role})
+	if err == repository.ErrNotFound {
+		return apierror.NotFound("user not found")
+	}
+	if err != nil {
+		return apierror.Internal("failed to update user").Wrap(err)
+	}
+
+	recordAuditTo(c, h.audit, models.AuditEvent{
+		Action:     models.AuditUserRoleChanged,
+		UserID:     &objID,
+		TargetType: "user",
+		TargetID:   &objID,
+		Before:     bson.M{"role": before.EffectiveRole()},
+		After:      bson.M{"role": req.Role},
+	})
+
+	if before.EffectiveRole() != req.Role {
+		if _, err := h.sessions.RevokeAll(ctx, objID); err != nil {
+			log.Printf("Failed to revoke sessions of user %s after a role change: %v", objID.Hex(), err)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "user role updated successfully",
+		"role":    req.Role,
+	})
+}
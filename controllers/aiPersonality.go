@@ -2,315 +2,144 @@ package controllers
 
 import (
     "context"
-    "errors"
     "time"
 
     "github.com/gofiber/fiber/v2"
-    "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
-    "go.mongodb.org/mongo-driver/mongo"
     "bytes"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"sync"
 
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
 )
 
 // Top 3 📚 by id 
-func GetTopBooksByUserID(db *mongo.Database, userID string) ([]fiber.Map, error) {
-    // Parse string userID to ObjectID
-    oid, err := primitive.ObjectIDFromHex(userID)
-    if err != nil {
-        return nil, errors.New("invalid user ID format")
-    }
-
-    // Create context with timeout
+func GetTopBooksByUserID(books repository.Repository[models.Book], userID primitive.ObjectID) ([]fiber.Map, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    collection := db.Collection("books")
-
-    // Find books by user ID
-    cursor, err := collection.Find(ctx, bson.M{"user_id": oid})
+    page, err := books.List(ctx, userID, repository.ListQuery{Limit: 3})
     if err != nil {
         return nil, err
     }
-    defer cursor.Close(ctx)
 
     var results []fiber.Map
-    count := 0
-
-    for cursor.Next(ctx) {
-        var book struct {
-            BookName string `bson:"book_name"`
-            Reason   string `bson:"reason"`
-        }
-
-        if err := cursor.Decode(&book); err != nil {
-            continue // skip malformed documents
-        }
-
+    for _, book := range page.Items {
         results = append(results, fiber.Map{
             "book_name": book.BookName,
             "reason":    book.Reason,
         })
-
-        count++
-        if count == 3 {
-            break
-        }
-    }
-
-    if err := cursor.Err(); err != nil {
-        return nil, err
     }
 
     return results, nil
 }
 
 // Top 3 🎬 by id
-func getTopMoviesByUserID(db *mongo.Database, userID string) ([]fiber.Map, error) {
-    oid, err := primitive.ObjectIDFromHex(userID)
-    if err != nil {
-        return nil, errors.New("invalid user ID format")
-    }
-
+func getTopMoviesByUserID(movies repository.Repository[models.Movie], userID primitive.ObjectID) ([]fiber.Map, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    collection := db.Collection("movies")
-
-    cursor, err := collection.Find(ctx, bson.M{"user_id": oid})
+    page, err := movies.List(ctx, userID, repository.ListQuery{Limit: 3})
     if err != nil {
         return nil, err
     }
-    defer cursor.Close(ctx)
 
     var results []fiber.Map
-    count := 0
-
-    for cursor.Next(ctx) {
-        var movie struct {
-            Title  string `bson:"title"`
-            Type   string `bson:"type"`
-            Reason string `bson:"reason"`
-        }
-
-        if err := cursor.Decode(&movie); err != nil {
-            continue
-        }
-
+    for _, movie := range page.Items {
         results = append(results, fiber.Map{
             "title":  movie.Title,
             "type":   movie.Type,
             "reason": movie.Reason,
         })
-
-        count++
-        if count == 3 {
-            break
-        }
-    }
-
-    if err := cursor.Err(); err != nil {
-        return nil, err
     }
 
     return results, nil
 }
 
 // Top 3 🐶 by id
-func getTopPetByUserID(db *mongo.Database, userID string) ([]fiber.Map, error) {
-    oid, err := primitive.ObjectIDFromHex(userID)
-    if err != nil {
-        return nil, errors.New("invalid user ID format")
-    }
-
+func getTopPetByUserID(pets repository.Repository[models.Pet], userID primitive.ObjectID) ([]fiber.Map, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    collection := db.Collection("pets")
-
-    cursor, err := collection.Find(ctx, bson.M{"user_id": oid})
+    page, err := pets.List(ctx, userID, repository.ListQuery{Limit: 3})
     if err != nil {
         return nil, err
     }
-    defer cursor.Close(ctx)
 
     var results []fiber.Map
-    count := 0
-
-    for cursor.Next(ctx) {
-        var pet struct {
-            Name   string `bson:"name"`
-            Reason string `bson:"reason"`
-        }
-
-        if err := cursor.Decode(&pet); err != nil {
-            continue
-        }
-
+    for _, pet := range page.Items {
         results = append(results, fiber.Map{
             "name":   pet.Name,
             "reason": pet.Reason,
         })
-
-        count++
-        if count == 3 {
-            break
-        }
-    }
-
-    if err := cursor.Err(); err != nil {
-        return nil, err
     }
 
     return results, nil
 }
 
 // Top 3 💬 by id
-func getTopQuotesByUserID(db *mongo.Database, userID string) ([]fiber.Map, error) {
-    oid, err := primitive.ObjectIDFromHex(userID)
-    if err != nil {
-        return nil, errors.New("invalid user ID format")
-    }
-
+func getTopQuotesByUserID(quotes repository.Repository[models.Quote], userID primitive.ObjectID) ([]fiber.Map, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    collection := db.Collection("quotes")
-
-    cursor, err := collection.Find(ctx, bson.M{"user_id": oid})
+    page, err := quotes.List(ctx, userID, repository.ListQuery{Limit: 3})
     if err != nil {
         return nil, err
     }
-    defer cursor.Close(ctx)
 
     var results []fiber.Map
-    count := 0
-
-    for cursor.Next(ctx) {
-        var quote struct {
-            Quote string `bson:"quote"`
-        }
-
-        if err := cursor.Decode(&quote); err != nil {
-            continue
-        }
-
+    for _, quote := range page.Items {
         results = append(results, fiber.Map{
             "quote": quote.Quote,
         })
-
-        count++
-        if count == 3 {
-            break
-        }
-    }
-
-    if err := cursor.Err(); err != nil {
-        return nil, err
     }
 
     return results, nil
 }
 
 // Top 3 🍜🍕 by id
-func getRecipeByUserID(db *mongo.Database, userID string) ([]fiber.Map, error) {
-    oid, err := primitive.ObjectIDFromHex(userID)
-    if err != nil {
-        return nil, errors.New("invalid user ID format")
-    }
-
+func getRecipeByUserID(recipes repository.Repository[models.Recipe], userID primitive.ObjectID) ([]fiber.Map, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    collection := db.Collection("recipes")
-
-    cursor, err := collection.Find(ctx, bson.M{"user_id": oid})
+    page, err := recipes.List(ctx, userID, repository.ListQuery{Limit: 3})
     if err != nil {
         return nil, err
     }
-    defer cursor.Close(ctx)
 
     var results []fiber.Map
-    count := 0
-
-    for cursor.Next(ctx) {
-        var recipe struct {
-            Name   string `bson:"name"`
-            Reason string `bson:"reason"`
-        }
-
-        if err := cursor.Decode(&recipe); err != nil {
-            continue
-        }
-
+    for _, recipe := range page.Items {
         results = append(results, fiber.Map{
             "name":   recipe.Name,
             "reason": recipe.Reason,
         })
-
-        count++
-        if count == 3 {
-            break
-        }
-    }
-
-    if err := cursor.Err(); err != nil {
-        return nil, err
     }
 
     return results, nil
 }
 
 // Top 3 ✈️🧳🚢 by id
-func GetTravelByUserID(db *mongo.Database, userID string) ([]fiber.Map, error) {
-    oid, err := primitive.ObjectIDFromHex(userID)
-    if err != nil {
-        return nil, errors.New("invalid user ID format")
-    }
-
+func GetTravelByUserID(travels repository.Repository[models.TravelBuddy], userID primitive.ObjectID) ([]fiber.Map, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    collection := db.Collection("travels")
-
-    cursor, err := collection.Find(ctx, bson.M{"user_id": oid})
+    page, err := travels.List(ctx, userID, repository.ListQuery{Limit: 3})
     if err != nil {
         return nil, err
     }
-    defer cursor.Close(ctx)
 
     var results []fiber.Map
-    count := 0
-
-    for cursor.Next(ctx) {
-        var travel struct {
-            PlaceName string `bson:"place_name"`
-            Reason    string `bson:"reason"`
-        }
-
-        if err := cursor.Decode(&travel); err != nil {
-            continue
-        }
-
+    for _, travel := range page.Items {
         results = append(results, fiber.Map{
             "place_name": travel.PlaceName,
             "reason":     travel.Reason,
         })
-
-        count++
-        if count == 3 {
-            break
-        }
-    }
-
-    if err := cursor.Err(); err != nil {
-        return nil, err
     }
 
     return results, nil
@@ -328,6 +157,9 @@ type UserData struct {
 	Travel  []fiber.Map `json:"travel"`
 }
 
+// geminiURL is the Gemini generateContent endpoint, replaceable in tests
+var geminiURL = "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent"
+
 // GeminiRequest represents the request structure for Gemini API
 type GeminiRequest struct {
 	Contents []struct {
@@ -348,51 +180,33 @@ type GeminiResponse struct {
 	} `json:"candidates"`
 }
 
-// PersonalityAnalysisRequest represents the request body
-type PersonalityAnalysisRequest struct {
-	UserID string `json:"user_id"`
-}
-
 // GetAIPersonalityAnalysis is the main controller function
-func GetAIPersonalityAnalysis(db *mongo.Database) fiber.Handler {
+func GetAIPersonalityAnalysis(store *repository.Store) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Parse request body
-		var req PersonalityAnalysisRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid request body",
-			})
-		}
+		// Analyse the authenticated user only; a user_id in the body is ignored
+		userID := auth.CurrentUserID(c).Hex()
 
-		// Validate user ID
-		if req.UserID == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "User ID is required",
-			})
-		}
+		recordAuditTo(c, store.Audit, models.AuditEvent{
+			Action: models.AuditAIAnalysisRequested,
+			UserID: objectIDRef(auth.CurrentUserID(c)),
+		})
 
 		// Collect user data using goroutines
-		userData, err := collectUserDataConcurrently(db, req.UserID)
+		userData, err := collectUserDataConcurrently(store, auth.CurrentUserID(c))
 		if err != nil {
-			log.Printf("Error collecting user data: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to collect user data",
-			})
+			return apierror.Internal("failed to collect user data").Wrap(err)
 		}
 
 		// Generate personality analysis using Gemini API
 		personalityAnalysis, err := generatePersonalityAnalysis(userData)
 		if err != nil {
-			log.Printf("Error generating personality analysis: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to generate personality analysis",
-			})
+			return apierror.Internal("failed to generate personality analysis").Wrap(err)
 		}
 
 		// Return the result
 		return c.JSON(fiber.Map{
 			"success":             true,
-			"user_id":            req.UserID,
+			"user_id":            userID,
 			"personality_analysis": personalityAnalysis,
 			"data_collected":      userData,
 		})
@@ -400,7 +214,7 @@ func GetAIPersonalityAnalysis(db *mongo.Database) fiber.Handler {
 }
 
 // collectUserDataConcurrently uses goroutines to fetch data from all collections
-func collectUserDataConcurrently(db *mongo.Database, userID string) (*UserData, error) {
+func collectUserDataConcurrently(store *repository.Store, userID primitive.ObjectID) (*UserData, error) {
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	
@@ -414,7 +228,7 @@ func collectUserDataConcurrently(db *mongo.Database, userID string) (*UserData,
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		books, err := GetTopBooksByUserID(db, userID)
+		books, err := GetTopBooksByUserID(store.Books, userID)
 		if err != nil {
 			errorChan <- fmt.Errorf("books error: %v", err)
 			return
@@ -428,7 +242,7 @@ func collectUserDataConcurrently(db *mongo.Database, userID string) (*UserData,
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		movies, err := getTopMoviesByUserID(db, userID)
+		movies, err := getTopMoviesByUserID(store.Movies, userID)
 		if err != nil {
 			errorChan <- fmt.Errorf("movies error: %v", err)
 			return
@@ -442,7 +256,7 @@ func collectUserDataConcurrently(db *mongo.Database, userID string) (*UserData,
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		pets, err := getTopPetByUserID(db, userID)
+		pets, err := getTopPetByUserID(store.Pets, userID)
 		if err != nil {
 			errorChan <- fmt.Errorf("pets error: %v", err)
 			return
@@ -456,7 +270,7 @@ func collectUserDataConcurrently(db *mongo.Database, userID string) (*UserData,
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		quotes, err := getTopQuotesByUserID(db, userID)
+		quotes, err := getTopQuotesByUserID(store.Quotes, userID)
 		if err != nil {
 			errorChan <- fmt.Errorf("quotes error: %v", err)
 			return
@@ -470,7 +284,7 @@ func collectUserDataConcurrently(db *mongo.Database, userID string) (*UserData,
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		recipes, err := getRecipeByUserID(db, userID)
+		recipes, err := getRecipeByUserID(store.Recipes, userID)
 		if err != nil {
 			errorChan <- fmt.Errorf("recipes error: %v", err)
 			return
@@ -484,7 +298,7 @@ func collectUserDataConcurrently(db *mongo.Database, userID string) (*UserData,
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		travel, err := GetTravelByUserID(db, userID)
+		travel, err := GetTravelByUserID(store.Travels, userID)
 		if err != nil {
 			errorChan <- fmt.Errorf("travel error: %v", err)
 			return
@@ -548,7 +362,7 @@ func generatePersonalityAnalysis(userData *UserData) (string, error) {
 	}
 
 	// Make API call to Gemini
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent?key=%s", apiKey)
+	url := fmt.Sprintf("%s?key=%s", geminiURL, apiKey)
 	
 	client := &http.Client{
 		Timeout: 30 * time.Second,
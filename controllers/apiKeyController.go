@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/middleware"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+)
+
+const (
+	maxAPIKeysPerUser = 25
+
+	// last_used_at is only rewritten once per interval to keep busy keys
+	// from causing a write on every request
+	apiKeyLastUsedInterval = time.Minute
+)
+
+// APIKeyHandler manages API keys and authenticates requests made with them
+type APIKeyHandler struct {
+	keys  repository.APIKeyRepository
+	users repository.UserRepository
+}
+
+func NewAPIKeyHandler(keys repository.APIKeyRepository, users repository.UserRepository) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys, users: users}
+}
+
+// CreateAPIKey issues a new API key for the current user. The key itself is
+// only returned in this response.
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	var req models.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return apierror.BadRequest(apierror.CodeMissingField, "name is required")
+	}
+	if len(req.Scopes) == 0 {
+		return apierror.BadRequest(apierror.CodeMissingField, "at least one scope is required")
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidAPIKeyScope(scope) {
+			return apierror.BadRequest(apierror.CodeInvalidScope, "unknown scope: "+scope).
+				With("valid_scopes", auth.APIKeyScopes)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return apierror.BadRequest(apierror.CodeInvalidField, "expires_at must be in the future")
+	}
+
+	userID := auth.CurrentUserID(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := h.keys.CountByUser(ctx, userID)
+	if err != nil {
+		return apierror.Internal("failed to count API keys").Wrap(err)
+	}
+	if count >= maxAPIKeysPerUser {
+		return apierror.Conflict(apierror.CodeAPIKeyLimitReached, "API key limit reached, delete an unused key first")
+	}
+
+	key, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return apierror.Internal("failed to generate API key").Wrap(err)
+	}
+
+	apiKey := models.APIKey{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := h.keys.Insert(ctx, apiKey); err != nil {
+		return apierror.Internal("failed to insert API key").Wrap(err)
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "store this key now, it won't be shown again",
+		"key":     key,
+		"api_key": apiKey,
+	})
+}
+
+// GetAPIKeys lists the current user's API keys without the secrets
+func (h *APIKeyHandler) GetAPIKeys(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	apiKeys, err := h.keys.ListByUser(ctx, auth.CurrentUserID(c))
+	if err != nil {
+		return apierror.Internal("failed to fetch API keys").Wrap(err)
+	}
+
+	return c.JSON(apiKeys)
+}
+
+// DeleteAPIKey revokes one of the current user's API keys
+func (h *APIKeyHandler) DeleteAPIKey(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidID, "invalid API key ID")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := h.keys.DeleteOwned(ctx, objID, auth.CurrentUserID(c)); err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.NotFound("API key not found")
+		}
+		return apierror.Internal("failed to delete API key").Wrap(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":       "API key deleted successfully",
+		"deleted_count": 1,
+	})
+}
+
+// ResolveAPIKey authenticates an "Authorization: ApiKey ..." header for the
+// auth middleware
+func (h *APIKeyHandler) ResolveAPIKey(ctx context.Context, key string) (*middleware.APIKeyPrincipal, error) {
+	now := time.Now()
+
+	apiKey, err := h.keys.FindActive(ctx, auth.HashOpaqueToken(key), now)
+	if err == repository.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.users.FindByID(ctx, apiKey.UserID)
+	if err == repository.ErrNotFound || (err == nil && user.Disabled) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.keys.MarkUsed(ctx, apiKey.ID, now, now.Add(-apiKeyLastUsedInterval)); err != nil {
+		log.Printf("Failed to update API key last use: %v", err)
+	}
+
+	return &middleware.APIKeyPrincipal{
+		UserID:        user.ID,
+		Email:         user.Email,
+		EmailVerified: user.Verified,
+		Scopes:        apiKey.Scopes,
+	}, nil
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+)
+
+// recordAuditTo stores an event about the current request, filling in the
+// actor, client details and request ID. A failure to record is logged but
+// never fails the request.
+func recordAuditTo(c *fiber.Ctx, l repository.AuditLog, event models.AuditEvent) {
+	event.ID = primitive.NewObjectID()
+	event.CreatedAt = time.Now()
+	event.IP = c.IP()
+	event.UserAgent = c.Get(fiber.HeaderUserAgent)
+	event.RequestID, _ = c.Locals(requestid.ConfigDefault.ContextKey).(string)
+	if event.ActorID == nil {
+		if actorID := auth.CurrentUserID(c); !actorID.IsZero() {
+			event.ActorID = &actorID
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := l.Insert(ctx, event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// objectIDRef returns a pointer for the optional ID fields of AuditEvent
+func objectIDRef(id primitive.ObjectID) *primitive.ObjectID {
+	return &id
+}
+
+// pageParams reads ?page= and ?limit= for paginated listings
+func pageParams(c *fiber.Ctx, defaultLimit, maxLimit int) (int, int, string) {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		return 0, 0, "page must be a positive integer"
+	}
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit < 1 || limit > maxLimit {
+		return 0, 0, "limit must be between 1 and " + strconv.Itoa(maxLimit)
+	}
+	return page, limit, ""
+}
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// AuditHandler serves the audit log queries
+type AuditHandler struct {
+	audit repository.AuditLog
+}
+
+func NewAuditHandler(audit repository.AuditLog) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+// GetMyActivity lists audit events concerning the authenticated user, newest
+// first. Supports ?page=, ?limit= and ?action=.
+func (h *AuditHandler) GetMyActivity(c *fiber.Ctx) error {
+	return h.list(c, repository.AuditQuery{
+		Involving: objectIDRef(auth.CurrentUserID(c)),
+		Action:    c.Query("action"),
+	})
+}
+
+// GetAuditEvents lets administrators query the audit log. Filters:
+// ?action=, ?user_id=, ?actor_id=, ?target_type=, ?target_id=, ?ip=,
+// ?request_id= and an RFC 3339 ?from= / ?to= range on the event time.
+func (h *AuditHandler) GetAuditEvents(c *fiber.Ctx) error {
+	query := repository.AuditQuery{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		IP:         c.Query("ip"),
+		RequestID:  c.Query("request_id"),
+	}
+
+	for key, dest := range map[string]**primitive.ObjectID{
+		"user_id":   &query.UserID,
+		"actor_id":  &query.ActorID,
+		"target_id": &query.TargetID,
+	} {
+		if value := c.Query(key); value != "" {
+			id, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				return apierror.BadRequest(apierror.CodeInvalidParameter, "invalid "+key)
+			}
+			*dest = &id
+		}
+	}
+
+	for key, dest := range map[string]**time.Time{"from": &query.From, "to": &query.To} {
+		if value := c.Query(key); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return apierror.BadRequest(apierror.CodeInvalidParameter, key+" must be an RFC 3339 timestamp")
+			}
+			*dest = &t
+		}
+	}
+
+	return h.list(c, query)
+}
+
+func (h *AuditHandler) list(c *fiber.Ctx, query repository.AuditQuery) error {
+	page, limit, msg := pageParams(c, defaultAuditPageSize, maxAuditPageSize)
+	if msg != "" {
+		return apierror.BadRequest(apierror.CodeInvalidParameter, msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events, total, err := h.audit.List(ctx, query, page, limit)
+	if err != nil {
+		return apierror.Internal("failed to fetch audit events").Wrap(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"events": events,
+		"page":   page,
+		"limit":  limit,
+		"total":  total,
+	})
+}
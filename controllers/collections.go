@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+)
+
+var booksResource = Resource[models.Book]{
+	Name:      "books",
+	Singular:  "book",
+	Plural:    "books",
+	Fields:    []string{"book_name", "author", "reason"},
+	Queryable: []string{"book_name", "author"},
+}
+
+var recipesResource = Resource[models.Recipe]{
+	Name:      "recipes",
+	Singular:  "recipe",
+	Plural:    "recipes",
+	Fields:    []string{"name", "ingredients", "reason"},
+	Queryable: []string{"name"},
+}
+
+var moviesResource = Resource[models.Movie]{
+	Name:      "movies",
+	Singular:  "movie",
+	Plural:    "movies",
+	Fields:    []string{"title", "type", "reason"},
+	Queryable: []string{"title", "type"},
+}
+
+var quotesResource = Resource[models.Quote]{
+	Name:      "quotes",
+	Singular:  "quote",
+	Plural:    "quotes",
+	Fields:    []string{"quote", "author"},
+	Queryable: []string{"author"},
+}
+
+var petsResource = Resource[models.Pet]{
+	Name:      "pets",
+	Singular:  "pet",
+	Plural:    "pets",
+	Fields:    []string{"name", "reason"},
+	Queryable: []string{"name"},
+}
+
+var travelsResource = Resource[models.TravelBuddy]{
+	Name:      "travels",
+	Singular:  "travel entry",
+	Plural:    "travel entries",
+	Fields:    []string{"place_name", "date_visited", "reason"},
+	Queryable: []string{"place_name", "date_visited"},
+	Defaults: func(travel *models.TravelBuddy) {
+		// If date_visited is not provided, the visit is happening now. MongoDB
+		// keeps milliseconds, so the response matches what is read back later.
+		if travel.DateVisited.IsZero() {
+			travel.DateVisited = time.Now().Truncate(time.Millisecond)
+		}
+	},
+}
+
+// NewCollections builds the resources of every user-owned collection on
+// top of store. A new collection is declared above, added here and to
+// repository.Store, and given read and write scopes in auth.APIKeyScopes.
+func NewCollections(store *repository.Store) []CollectionResource {
+	return []CollectionResource{
+		NewResource(booksResource, store.Books, store.Audit),
+		NewResource(recipesResource, store.Recipes, store.Audit),
+		NewResource(moviesResource, store.Movies, store.Audit),
+		NewResource(quotesResource, store.Quotes, store.Audit),
+		NewResource(petsResource, store.Pets, store.Audit),
+		NewResource(travelsResource, store.Travels, store.Audit),
+	}
+}
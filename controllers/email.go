@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+var errInvalidEmail = errors.New("invalid email address")
+
+// normalizeEmail validates a bare address such as "a@example.com" and
+// case-folds it so "A@Example.com" and "a@example.com" are the same account
+func normalizeEmail(raw string) (string, error) {
+	email := strings.TrimSpace(raw)
+	if email == "" || len(email) > 254 {
+		return "", errInvalidEmail
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", errInvalidEmail
+	}
+
+	local, domain, found := strings.Cut(addr.Address, "@")
+	if !found || local == "" || len(local) > 64 {
+		return "", errInvalidEmail
+	}
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", errInvalidEmail
+	}
+
+	return strings.ToLower(addr.Address), nil
+}
@@ -0,0 +1,17 @@
+package controllers
+
+import "time"
+
+// SetTOTPClock makes TOTP checks use clock until restore is called
+func SetTOTPClock(clock func() time.Time) (restore func()) {
+	totpClock = clock
+	return func() { totpClock = time.Now }
+}
+
+// SetGeminiURL sends personality analysis requests to url until restore is
+// called
+func SetGeminiURL(url string) (restore func()) {
+	previous := geminiURL
+	geminiURL = url
+	return func() { geminiURL = previous }
+}
@@ -0,0 +1,1631 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/controllers"
+	"github.com/kashyapprajapat/collecthub_api/mailer"
+	"github.com/kashyapprajapat/collecthub_api/middleware"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+	"github.com/kashyapprajapat/collecthub_api/routes"
+	"github.com/kashyapprajapat/collecthub_api/sso"
+	"github.com/kashyapprajapat/collecthub_api/validation"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("JWT_SECRET", "handler-tests-secret-that-is-long-enough")
+	if err := auth.Init(); err != nil {
+		panic(err)
+	}
+	// Cheap hashes keep the many logins fast; legacy hashes use less still
+	os.Setenv("BCRYPT_COST", "6")
+	if err := auth.InitPasswords(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+const testPassword = "correct horse battery staple"
+
+// testServer is the API as mounted in production, wired to an in-memory
+// store
+type testServer struct {
+	app   *fiber.App
+	store *repository.Store
+	mail  testMailer
+}
+
+// testMailer hands sent messages to the test instead of delivering them
+type testMailer chan mailer.Message
+
+func (m testMailer) Send(_ context.Context, msg mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerWith(t, nil)
+}
+
+// newTestServerWith also enables sign-in through an identity provider
+func newTestServerWith(t *testing.T, provider *sso.Provider) *testServer {
+	t.Helper()
+
+	store := repository.NewMemoryStore()
+	mail := make(testMailer, 100)
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	app.Use(middleware.RequestID())
+	routes.RegisterAPI(app, store, mail, provider)
+
+	return &testServer{app: app, store: store, mail: mail}
+}
+
+// nextMail waits for the next message sent, which may be sent after the
+// response
+func (s *testServer) nextMail(t *testing.T) mailer.Message {
+	t.Helper()
+
+	select {
+	case msg := <-s.mail:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail sent")
+		return mailer.Message{}
+	}
+}
+
+// noMail checks nothing was sent, allowing for mail sent in the background
+func (s *testServer) noMail(t *testing.T) {
+	t.Helper()
+
+	select {
+	case msg := <-s.mail:
+		t.Fatalf("unexpected mail to %s: %s", msg.To, msg.Subject)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+var mailedToken = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// tokenFromMail returns the token in the link of a message
+func tokenFromMail(t *testing.T, msg mailer.Message) string {
+	t.Helper()
+
+	match := mailedToken.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("no token link in mail:\n%s", msg.Body)
+	}
+	return match[1]
+}
+
+// addAPIKey returns a credential acting as user with the given scopes,
+// to pass to request in place of a token
+func (s *testServer) addAPIKey(t *testing.T, user models.User, scopes ...string) string {
+	t.Helper()
+
+	key, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		t.Fatalf("new API key: %v", err)
+	}
+	err = s.store.APIKeys.Insert(context.Background(), models.APIKey{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Name:      "test",
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("insert API key: %v", err)
+	}
+	return "ApiKey " + key
+}
+
+// addUser stores an account and returns an access token for it
+func (s *testServer) addUser(t *testing.T, name, email, role string) (models.User, string) {
+	t.Helper()
+
+	user := models.User{
+		ID:       primitive.NewObjectID(),
+		Name:     name,
+		Email:    email,
+		Verified: true,
+		Role:     role,
+	}
+	if err := s.store.Users.Insert(context.Background(), user); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	return user, s.tokenFor(t, user)
+}
+
+// tokenFor starts a new session for user and returns its access token
+func (s *testServer) tokenFor(t *testing.T, user models.User) string {
+	t.Helper()
+
+	_, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	session := models.Session{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		FamilyID:  primitive.NewObjectID(),
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err := s.store.Sessions.Insert(context.Background(), session); err != nil {
+		t.Fatalf("insert session: %v", err)
+	}
+
+	token, _, err := auth.IssueAccessToken(auth.Identity{
+		UserID:        user.ID,
+		Email:         user.Email,
+		EmailVerified: user.Verified,
+		Role:          user.EffectiveRole(),
+		SessionID:     session.FamilyID.Hex(),
+	})
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+	return token
+}
+
+// setPassword gives user a password to log in with
+func (s *testServer) setPassword(t *testing.T, user models.User, password string) {
+	t.Helper()
+
+	hash, err := controllers.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.Users.Update(context.Background(), user.ID, map[string]interface{}{"password": hash}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// login signs in with a password and returns the new session's tokens
+func (s *testServer) login(t *testing.T, email, password string) models.LoginResponse {
+	t.Helper()
+
+	var resp struct {
+		User models.LoginResponse `json:"user"`
+	}
+	status := s.do(t, "POST", "/api/users/login", "", fiber.Map{"email": email, "password": password}, &resp)
+	if status != 200 || resp.User.Token == "" {
+		t.Fatalf("login as %s: status %d, response %+v", email, status, resp)
+	}
+	return resp.User
+}
+
+// request sends a request with an optional JSON body and bearer token, or
+// an API key credential from addAPIKey
+func (s *testServer) request(t *testing.T, method, path, token string, body interface{}) *http.Response {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if strings.HasPrefix(token, "ApiKey ") {
+		req.Header.Set(fiber.HeaderAuthorization, token)
+	} else if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp
+}
+
+// do sends a request and decodes the JSON response into out, when given
+func (s *testServer) do(t *testing.T, method, path, token string, body interface{}, out interface{}) int {
+	t.Helper()
+
+	resp := s.request(t, method, path, token, body)
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestRequiresAuthentication(t *testing.T) {
+	s := newTestServer(t)
+
+	if status := s.do(t, "GET", "/api/users/me", "", nil, nil); status != 401 {
+		t.Fatalf("status = %d, want 401", status)
+	}
+	if status := s.do(t, "GET", "/api/users/me", "not-a-token", nil, nil); status != 401 {
+		t.Fatalf("status with bad token = %d, want 401", status)
+	}
+}
+
+func TestErrorsAreProblemDocuments(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	id := primitive.NewObjectID().Hex()
+	req := httptest.NewRequest("GET", "/api/books/"+id, nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	req.Header.Set(fiber.HeaderXRequestID, "req-123")
+
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != apierror.ContentType {
+		t.Fatalf("Content-Type = %q, want %q", ct, apierror.ContentType)
+	}
+
+	var problem map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"type":       "urn:collecthub:problem:not_found",
+		"title":      "Resource not found",
+		"status":     float64(404),
+		"detail":     "book not found",
+		"instance":   "/api/books/" + id,
+		"code":       apierror.CodeNotFound,
+		"request_id": resp.Header.Get(fiber.HeaderXRequestID),
+	}
+	if !reflect.DeepEqual(problem, want) {
+		t.Fatalf("problem = %v, want %v", problem, want)
+	}
+	if id := problem["request_id"]; id == "" || id == "req-123" {
+		t.Fatalf("request_id = %v, want one generated by the server", id)
+	}
+
+	// Errors raised by Fiber itself use the same format
+	var unknown map[string]interface{}
+	if status := s.do(t, "GET", "/nowhere", "", nil, &unknown); status != 404 || unknown["code"] != apierror.CodeNotFound {
+		t.Fatalf("unknown route: status %d, problem %v", status, unknown)
+	}
+
+	var unauthenticated map[string]interface{}
+	s.do(t, "GET", "/api/users/me", "", nil, &unauthenticated)
+	if unauthenticated["code"] != apierror.CodeUnauthenticated {
+		t.Fatalf("code = %v, want %s", unauthenticated["code"], apierror.CodeUnauthenticated)
+	}
+}
+
+func TestBookCRUD(t *testing.T) {
+	s := newTestServer(t)
+	owner, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	status := s.do(t, "POST", "/api/books", token, fiber.Map{
+		"book_name": "Dune",
+		"author":    "Frank Herbert",
+		"user_id":   primitive.NewObjectID(), // ignored, the owner comes from the token
+	}, &created)
+	if status != 201 {
+		t.Fatalf("create status = %d, want 201", status)
+	}
+
+	var book models.Book
+	if status := s.do(t, "GET", "/api/books/"+created.ID, token, nil, &book); status != 200 {
+		t.Fatalf("get status = %d, want 200", status)
+	}
+	if book.BookName != "Dune" || book.UserID != owner.ID {
+		t.Fatalf("got %+v, want Dune owned by %s", book, owner.ID.Hex())
+	}
+
+	var updated models.Book
+	if status := s.do(t, "PATCH", "/api/books/"+created.ID, token, fiber.Map{"reason": "Spice"}, &updated); status != 200 {
+		t.Fatalf("update status = %d, want 200", status)
+	}
+	if updated.Reason != "Spice" || updated.BookName != "Dune" {
+		t.Fatalf("updated = %+v, want Dune with the new reason", updated)
+	}
+
+	var list struct {
+		Items      []models.Book `json:"items"`
+		NextCursor *string       `json:"next_cursor"`
+	}
+	if status := s.do(t, "GET", "/api/books/user/"+owner.ID.Hex(), token, nil, &list); status != 200 {
+		t.Fatalf("list status = %d, want 200", status)
+	}
+	books := list.Items
+	if len(books) != 1 || books[0].Reason != "Spice" || books[0].Author != "Frank Herbert" || list.NextCursor != nil {
+		t.Fatalf("list = %+v, want the updated book and no next page", list)
+	}
+
+	if status := s.do(t, "DELETE", "/api/books/"+created.ID, token, nil, nil); status != 200 {
+		t.Fatalf("delete status = %d, want 200", status)
+	}
+	if status := s.do(t, "GET", "/api/books/"+created.ID, token, nil, nil); status != 404 {
+		t.Fatalf("get after delete status = %d, want 404", status)
+	}
+
+	events, _, _ := s.store.Audit.List(context.Background(), repository.AuditQuery{Action: models.AuditItemDeleted}, 1, 10)
+	if len(events) != 1 || events[0].TargetType != "books" || events[0].Before["book_name"] != "Dune" {
+		t.Fatalf("audit events = %+v, want one books deletion of Dune", events)
+	}
+}
+
+func TestCreateReturnsStoredDocument(t *testing.T) {
+	s := newTestServer(t)
+	owner, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	bodies := map[string]fiber.Map{
+		"books":   {"book_name": "Dune"},
+		"recipes": {"name": "Pasta"},
+		"movies":  {"title": "Dark", "type": "series"},
+		"quotes":  {"quote": "Stay hungry"},
+		"pets":    {"name": "Buddy"},
+		"travels": {"place_name": "Kyoto", "reason": "Temples"},
+	}
+	for name, body := range bodies {
+		resp := s.request(t, "POST", "/api/"+name, token, body)
+		var created map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			t.Fatalf("%s: decode: %v", name, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != 201 {
+			t.Errorf("%s: status = %d, want 201", name, resp.StatusCode)
+			continue
+		}
+		id, _ := created["id"].(string)
+		if location := resp.Header.Get(fiber.HeaderLocation); location != "/api/"+name+"/"+id {
+			t.Errorf("%s: Location = %q, want /api/%s/%s", name, location, name, id)
+		}
+		if created["user_id"] != owner.ID.Hex() {
+			t.Errorf("%s: user_id = %v, want %s", name, created["user_id"], owner.ID.Hex())
+		}
+
+		var fetched map[string]interface{}
+		s.do(t, "GET", "/api/"+name+"/"+id, token, nil, &fetched)
+		if !reflect.DeepEqual(created, fetched) {
+			t.Errorf("%s: created %v, but GET returns %v", name, created, fetched)
+		}
+	}
+}
+
+func TestCreateValidatesFields(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	tests := []struct {
+		path string
+		body fiber.Map
+		want []validation.Error
+	}{
+		{"/api/books", fiber.Map{"author": "Nobody"}, []validation.Error{
+			{Field: "book_name", Code: validation.CodeRequired, Message: "book_name is required"},
+		}},
+		{"/api/books", fiber.Map{"book_name": "   "}, []validation.Error{
+			{Field: "book_name", Code: validation.CodeRequired, Message: "book_name is required"},
+		}},
+		{"/api/travels", fiber.Map{"place_name": strings.Repeat("a", 201)}, []validation.Error{
+			{Field: "place_name", Code: validation.CodeTooLong, Message: "place_name must be at most 200 characters"},
+			{Field: "reason", Code: validation.CodeRequired, Message: "reason is required"},
+		}},
+		{"/api/travels", fiber.Map{"place_name": "Mars", "reason": "Why not", "date_visited": time.Now().Add(48 * time.Hour)}, []validation.Error{
+			{Field: "date_visited", Code: validation.CodeFutureDate, Message: "date_visited cannot be in the future"},
+		}},
+		{"/api/movies", fiber.Map{"title": "Dark", "type": "podcast"}, []validation.Error{
+			{Field: "type", Code: validation.CodeNotAllowed, Message: "type must be one of: movie, series"},
+		}},
+	}
+
+	for _, tt := range tests {
+		var body struct {
+			Errors []validation.Error `json:"errors"`
+		}
+		if status := s.do(t, "POST", tt.path, token, tt.body, &body); status != 422 {
+			t.Errorf("POST %s %v: status = %d, want 422", tt.path, tt.body, status)
+			continue
+		}
+		if !reflect.DeepEqual(body.Errors, tt.want) {
+			t.Errorf("POST %s %v: errors = %+v, want %+v", tt.path, tt.body, body.Errors, tt.want)
+		}
+	}
+
+	// Updates check the whole resulting document
+	var created struct {
+		ID string `json:"id"`
+	}
+	s.do(t, "POST", "/api/movies", token, fiber.Map{"title": "Dark", "type": "series"}, &created)
+	if status := s.do(t, "PATCH", "/api/movies/"+created.ID, token, fiber.Map{"type": "podcast"}, nil); status != 422 {
+		t.Errorf("invalid patch status = %d, want 422", status)
+	}
+	if status := s.do(t, "PATCH", "/api/movies/"+created.ID, token, fiber.Map{"title": nil}, nil); status != 422 {
+		t.Errorf("patch clearing a required field: status = %d, want 422", status)
+	}
+	if status := s.do(t, "PUT", "/api/movies/"+created.ID, token, fiber.Map{"reason": "Time travel"}, nil); status != 422 {
+		t.Errorf("replacement without a title: status = %d, want 422", status)
+	}
+	if status := s.do(t, "PATCH", "/api/movies/"+created.ID, token, fiber.Map{"reason": "Time travel"}, nil); status != 200 {
+		t.Errorf("valid patch status = %d, want 200", status)
+	}
+}
+
+func TestUpdates(t *testing.T) {
+	s := newTestServer(t)
+	owner, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	var book models.Book
+	s.do(t, "POST", "/api/books", token, fiber.Map{"book_name": "Dune", "author": "Frank Herbert", "reason": "Spice"}, &book)
+	path := "/api/books/" + book.ID.Hex()
+
+	// PUT replaces the whole document, so author is cleared
+	var replaced models.Book
+	if status := s.do(t, "PUT", path, token, fiber.Map{"book_name": "Dune Messiah", "reason": "Sequel"}, &replaced); status != 200 {
+		t.Fatalf("PUT status = %d, want 200", status)
+	}
+	want := models.Book{ID: book.ID, BookName: "Dune Messiah", Reason: "Sequel", UserID: owner.ID,
+		CreatedAt: book.CreatedAt, UpdatedAt: replaced.UpdatedAt, Version: 2}
+	if replaced != want || replaced.UpdatedAt.Before(book.CreatedAt) {
+		t.Fatalf("PUT = %+v, want %+v", replaced, want)
+	}
+
+	// A merge patch changes what it names; null clears, and the server
+	// fields can't be patched
+	var merged models.Book
+	status := s.do(t, "PATCH", path, token, fiber.Map{
+		"author":     "Frank Herbert",
+		"reason":     nil,
+		"user_id":    primitive.NewObjectID(),
+		"created_at": "2000-01-01T00:00:00Z",
+		"version":    99,
+	}, &merged)
+	if status != 200 {
+		t.Fatalf("merge patch status = %d, want 200", status)
+	}
+	want = models.Book{ID: book.ID, BookName: "Dune Messiah", Author: "Frank Herbert", UserID: owner.ID,
+		CreatedAt: book.CreatedAt, UpdatedAt: merged.UpdatedAt, Version: 3}
+	if merged != want {
+		t.Fatalf("merge patch = %+v, want %+v", merged, want)
+	}
+
+	patchAs := func(contentType, body string) *http.Response {
+		req := httptest.NewRequest("PATCH", path, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, contentType)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		resp, err := s.app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := patchAs("application/json-patch+json", `[
+		{"op": "test", "path": "/author", "value": "Frank Herbert"},
+		{"op": "copy", "from": "/author", "path": "/reason"},
+		{"op": "replace", "path": "/book_name", "value": "Children of Dune"}
+	]`)
+	var patched models.Book
+	json.NewDecoder(resp.Body).Decode(&patched)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || patched.BookName != "Children of Dune" || patched.Reason != "Frank Herbert" {
+		t.Fatalf("JSON patch: status %d, book %+v", resp.StatusCode, patched)
+	}
+
+	for _, tt := range []struct {
+		contentType, body string
+		status            int
+	}{
+		{"application/json-patch+json", `[{"op": "test", "path": "/author", "value": "Someone else"}]`, 409},
+		{"application/json-patch+json", `[{"op": "remove", "path": "/missing"}]`, 400},
+		{"application/json-patch+json", `{"op": "remove"}`, 400},
+		{"application/merge-patch+json", `["not", "an", "object"]`, 400},
+		{"text/plain", `reason=nope`, 415},
+	} {
+		resp := patchAs(tt.contentType, tt.body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("PATCH %s %s: status = %d, want %d", tt.contentType, tt.body, resp.StatusCode, tt.status)
+		}
+	}
+
+	// Failed patches leave the document alone
+	var stored models.Book
+	s.do(t, "GET", path, token, nil, &stored)
+	if stored != patched {
+		t.Fatalf("stored = %+v, want %+v", stored, patched)
+	}
+
+	// Clearing a field with a default sets it to the default again
+	var travel models.TravelBuddy
+	s.do(t, "POST", "/api/travels", token, fiber.Map{"place_name": "Lisbon", "reason": "Trams", "date_visited": "2021-09-15T00:00:00Z"}, &travel)
+	travelPath := "/api/travels/" + travel.ID.Hex()
+	before := time.Now().Add(-time.Second)
+	s.do(t, "PATCH", travelPath, token, fiber.Map{"date_visited": nil}, &travel)
+	if travel.DateVisited.Before(before) {
+		t.Errorf("date_visited after a null merge patch = %v, want now", travel.DateVisited)
+	}
+	s.do(t, "PUT", travelPath, token, fiber.Map{"place_name": "Lisbon", "reason": "Trams", "date_visited": "2021-09-15T00:00:00Z"}, nil)
+	req := httptest.NewRequest("PATCH", travelPath, strings.NewReader(`[{"op": "remove", "path": "/date_visited"}]`))
+	req.Header.Set(fiber.HeaderContentType, "application/json-patch+json")
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&travel)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || travel.DateVisited.Before(before) {
+		t.Errorf("JSON patch removing date_visited: status %d, date_visited %v, want now", resp.StatusCode, travel.DateVisited)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	s := newTestServer(t)
+	owner, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	send := func(method, path string, header map[string]string, body interface{}) *http.Response {
+		t.Helper()
+		var reader io.Reader
+		if body != nil {
+			data, _ := json.Marshal(body)
+			reader = bytes.NewReader(data)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := s.app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	var pet models.Pet
+	resp := s.request(t, "POST", "/api/pets", token, fiber.Map{"name": "Biscuit"})
+	json.NewDecoder(resp.Body).Decode(&pet)
+	resp.Body.Close()
+	if etag := resp.Header.Get(fiber.HeaderETag); etag != `"1"` || pet.Version != 1 {
+		t.Fatalf("created ETag %q, version %d, want \"1\" and 1", etag, pet.Version)
+	}
+	if pet.CreatedAt.IsZero() || !pet.UpdatedAt.Equal(pet.CreatedAt) {
+		t.Fatalf("created_at = %v, updated_at = %v, want both set to the same time", pet.CreatedAt, pet.UpdatedAt)
+	}
+	path := "/api/pets/" + pet.ID.Hex()
+
+	if resp := send("GET", path, nil, nil); resp.StatusCode != 200 || resp.Header.Get(fiber.HeaderETag) != `"1"` {
+		t.Fatalf("GET: status %d, ETag %q", resp.StatusCode, resp.Header.Get(fiber.HeaderETag))
+	}
+	if resp := send("GET", path, map[string]string{fiber.HeaderIfNoneMatch: `"1"`}, nil); resp.StatusCode != 304 {
+		t.Errorf("GET with a current If-None-Match: status = %d, want 304", resp.StatusCode)
+	}
+
+	// Every update needs the current ETag, when the client sends one
+	resp = send("PUT", path, map[string]string{fiber.HeaderIfMatch: `"1"`}, fiber.Map{"name": "Biscuit II"})
+	if resp.StatusCode != 200 || resp.Header.Get(fiber.HeaderETag) != `"2"` {
+		t.Fatalf("PUT with the current ETag: status %d, ETag %q", resp.StatusCode, resp.Header.Get(fiber.HeaderETag))
+	}
+	for _, tt := range []struct {
+		method string
+		body   interface{}
+	}{
+		{"PUT", fiber.Map{"name": "Stale"}},
+		{"PATCH", fiber.Map{"reason": "Stale"}},
+		{"DELETE", nil},
+	} {
+		if resp := send(tt.method, path, map[string]string{fiber.HeaderIfMatch: `"1"`}, tt.body); resp.StatusCode != 412 {
+			t.Errorf("%s with a stale ETag: status = %d, want 412", tt.method, resp.StatusCode)
+		}
+	}
+	if resp := send("PATCH", path, map[string]string{fiber.HeaderIfMatch: `W/"2"`}, fiber.Map{"reason": "Weak"}); resp.StatusCode != 412 {
+		t.Errorf("PATCH with a weak ETag: status = %d, want 412", resp.StatusCode)
+	}
+
+	var stored models.Pet
+	s.do(t, "GET", path, token, nil, &stored)
+	if stored.Name != "Biscuit II" || stored.Reason != "" || stored.Version != 2 || !stored.CreatedAt.Equal(pet.CreatedAt) {
+		t.Fatalf("stored = %+v, want only the first PUT applied", stored)
+	}
+
+	if resp := send("PATCH", path, map[string]string{fiber.HeaderIfMatch: `"7", "2"`}, fiber.Map{"reason": "Fluffy"}); resp.StatusCode != 200 {
+		t.Errorf("PATCH with the current ETag in a list: status = %d, want 200", resp.StatusCode)
+	}
+	if resp := send("PATCH", path, nil, fiber.Map{"reason": "Fluffier"}); resp.StatusCode != 200 || resp.Header.Get(fiber.HeaderETag) != `"4"` {
+		t.Errorf("PATCH without If-Match: status %d, ETag %q", resp.StatusCode, resp.Header.Get(fiber.HeaderETag))
+	}
+	if resp := send("DELETE", path, map[string]string{fiber.HeaderIfMatch: "*"}, nil); resp.StatusCode != 200 {
+		t.Errorf("DELETE with If-Match: *: status = %d, want 200", resp.StatusCode)
+	}
+	if resp := send("DELETE", path, map[string]string{fiber.HeaderIfMatch: "*"}, nil); resp.StatusCode != 404 {
+		t.Errorf("DELETE of a deleted pet: status = %d, want 404", resp.StatusCode)
+	}
+
+	// Lists sort by the timestamps like any queryable field
+	for _, name := range []string{"Alpha", "Beta"} {
+		s.do(t, "POST", "/api/pets", token, fiber.Map{"name": name}, nil)
+	}
+	var list struct {
+		Items []models.Pet `json:"items"`
+	}
+	since := url.QueryEscape(pet.CreatedAt.Format(time.RFC3339Nano))
+	if status := s.do(t, "GET", "/api/pets/user/"+owner.ID.Hex()+"?sort=-created_at&filter[updated_at][gte]="+since, token, nil, &list); status != 200 {
+		t.Fatalf("sort by created_at: status = %d, want 200", status)
+	}
+	if len(list.Items) != 2 || list.Items[0].Name != "Beta" || list.Items[1].Name != "Alpha" {
+		t.Errorf("newest first = %+v, want Beta then Alpha", list.Items)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+	list := "/api/books/user/" + user.ID.Hex()
+
+	// Two books share an author, so sorting by author needs the ID tiebreak
+	for _, book := range []fiber.Map{
+		{"book_name": "Dune", "author": "Herbert"},
+		{"book_name": "Emma", "author": "Austen"},
+		{"book_name": "Persuasion", "author": "Austen"},
+		{"book_name": "Ubik", "author": "Dick"},
+		{"book_name": "Beloved", "author": "Morrison"},
+	} {
+		if status := s.do(t, "POST", "/api/books", token, book, nil); status != 201 {
+			t.Fatalf("create status = %d, want 201", status)
+		}
+	}
+
+	type page struct {
+		Items      []map[string]interface{} `json:"items"`
+		NextCursor *string                  `json:"next_cursor"`
+		Total      *int64                   `json:"total"`
+	}
+	// walk follows next_cursor through every page and returns the titles
+	walk := func(query string) []string {
+		var titles []string
+		path := list + "?" + query
+		for pages := 0; ; pages++ {
+			if pages > 5 {
+				t.Fatalf("%s: too many pages", query)
+			}
+			var p page
+			if status := s.do(t, "GET", path, token, nil, &p); status != 200 {
+				t.Fatalf("GET %s: status = %d, want 200", path, status)
+			}
+			if len(p.Items) > 2 {
+				t.Fatalf("GET %s: %d items, want at most 2", path, len(p.Items))
+			}
+			for _, item := range p.Items {
+				titles = append(titles, item["book_name"].(string))
+			}
+			if p.NextCursor == nil {
+				return titles
+			}
+			path = list + "?" + query + "&after=" + url.QueryEscape(*p.NextCursor)
+		}
+	}
+
+	for query, want := range map[string]string{
+		"limit=2":                 "Dune Emma Persuasion Ubik Beloved",
+		"limit=2&sort=-id":        "Beloved Ubik Persuasion Emma Dune",
+		"limit=2&sort=book_name":  "Beloved Dune Emma Persuasion Ubik",
+		"limit=2&sort=author":     "Emma Persuasion Ubik Dune Beloved",
+		"limit=2&sort=-author":    "Beloved Dune Ubik Persuasion Emma",
+		"limit=2&sort=-book_name": "Ubik Persuasion Emma Dune Beloved",
+	} {
+		if got := strings.Join(walk(query), " "); got != want {
+			t.Errorf("%s: got %s, want %s", query, got, want)
+		}
+	}
+
+	var p page
+	s.do(t, "GET", list+"?limit=1&count=true&fields=book_name", token, nil, &p)
+	if p.Total == nil || *p.Total != 5 {
+		t.Errorf("total = %v, want 5", p.Total)
+	}
+	if len(p.Items) != 1 || len(p.Items[0]) != 2 || p.Items[0]["id"] == nil || p.Items[0]["book_name"] != "Dune" {
+		t.Errorf("projected items = %v, want only id and book_name", p.Items)
+	}
+	if p.NextCursor == nil {
+		t.Fatal("next_cursor = null on the first of five pages")
+	}
+	cursor := url.QueryEscape(*p.NextCursor)
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=101",
+		"sort=reason",
+		"fields=book_name,secret",
+		"after=not-a-cursor",
+		"sort=author&after=" + cursor, // made for the default order
+	} {
+		if status := s.do(t, "GET", list+"?"+query, token, nil, nil); status != 400 {
+			t.Errorf("%s: status = %d, want 400", query, status)
+		}
+	}
+}
+
+func TestListSortsByDate(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	for _, travel := range []fiber.Map{
+		{"place_name": "Kyoto", "date_visited": "2023-04-01T00:00:00Z", "reason": "Temples"},
+		{"place_name": "Lisbon", "date_visited": "2021-09-15T00:00:00Z", "reason": "Trams"},
+		{"place_name": "Oslo", "date_visited": "2024-01-20T00:00:00Z", "reason": "Fjords"},
+	} {
+		if status := s.do(t, "POST", "/api/travels", token, travel, nil); status != 201 {
+			t.Fatalf("create status = %d, want 201", status)
+		}
+	}
+
+	var places []string
+	path := "/api/travels/user/" + user.ID.Hex() + "?limit=1&sort=-date_visited"
+	for next := ""; ; {
+		var p struct {
+			Items      []models.TravelBuddy `json:"items"`
+			NextCursor *string              `json:"next_cursor"`
+		}
+		if status := s.do(t, "GET", path+next, token, nil, &p); status != 200 {
+			t.Fatalf("GET %s: status = %d, want 200", path+next, status)
+		}
+		for _, travel := range p.Items {
+			places = append(places, travel.PlaceName)
+		}
+		if p.NextCursor == nil || len(places) > 3 {
+			break
+		}
+		next = "&after=" + url.QueryEscape(*p.NextCursor)
+	}
+	if got := strings.Join(places, " "); got != "Oslo Kyoto Lisbon" {
+		t.Errorf("newest first: got %s, want Oslo Kyoto Lisbon", got)
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	for _, movie := range []fiber.Map{
+		{"title": "Alien", "type": "movie"},
+		{"title": "Dark", "type": "series"},
+		{"title": "Heat", "type": "movie"},
+		{"title": "Severance", "type": "series"},
+	} {
+		s.do(t, "POST", "/api/movies", token, movie, nil)
+	}
+	for _, travel := range []fiber.Map{
+		{"place_name": "Kyoto", "date_visited": "2023-04-01T00:00:00Z", "reason": "Temples"},
+		{"place_name": "Lisbon", "date_visited": "2024-02-10T12:00:00Z", "reason": "Trams"},
+		{"place_name": "Oslo", "date_visited": "2024-06-20T00:00:00Z", "reason": "Fjords"},
+	} {
+		s.do(t, "POST", "/api/travels", token, travel, nil)
+	}
+
+	type page struct {
+		Items []map[string]interface{} `json:"items"`
+		Total int64                    `json:"total"`
+	}
+	names := func(collection, field, query string) (string, int64) {
+		var p page
+		path := "/api/" + collection + "/user/" + user.ID.Hex() + "?count=true&" + query
+		if status := s.do(t, "GET", path, token, nil, &p); status != 200 {
+			t.Fatalf("GET %s: status = %d, want 200", path, status)
+		}
+		var got []string
+		for _, item := range p.Items {
+			got = append(got, item[field].(string))
+		}
+		return strings.Join(got, " "), p.Total
+	}
+
+	for _, tc := range []struct {
+		collection, field, query, want string
+	}{
+		{"movies", "title", "filter[type]=series", "Dark Severance"},
+		{"movies", "title", "filter[type][ne]=series", "Alien Heat"},
+		{"movies", "title", "filter[title][in]=Heat,Dark,Up", "Dark Heat"},
+		{"movies", "title", "filter[title][contains]=EA", "Heat"},
+		{"movies", "title", "filter[type]=movie&filter[title][gt]=B", "Heat"},
+		{"movies", "title", "filter[type]=movie&sort=-title&limit=1", "Heat"},
+		{"travels", "place_name", "filter[date_visited][gte]=2024-01-01", "Lisbon Oslo"},
+		{"travels", "place_name", "filter[date_visited][gte]=2024-01-01&filter[date_visited][lt]=2024-06-01", "Lisbon"},
+		{"travels", "place_name", "filter[date_visited]=2023-04-01", "Kyoto"},
+		{"travels", "place_name", "filter[date_visited][lte]=2024-02-10T12:00:00Z", "Kyoto Lisbon"},
+		// Values are data, not operators
+		{"movies", "title", "filter[type]={\"$ne\":\"\"}", ""},
+	} {
+		got, total := names(tc.collection, tc.field, tc.query)
+		if got != tc.want {
+			t.Errorf("%s %s: got %q, want %q", tc.collection, tc.query, got, tc.want)
+		}
+		if !strings.Contains(tc.query, "limit") && total != int64(len(strings.Fields(tc.want))) {
+			t.Errorf("%s %s: total = %d, want the number of matches", tc.collection, tc.query, total)
+		}
+	}
+	if _, total := names("movies", "title", "filter[type]=movie&limit=1"); total != 2 {
+		t.Errorf("total of a filtered page = %d, want 2 matches", total)
+	}
+
+	for _, query := range []string{
+		"filter[reason]=x",        // not queryable
+		"filter[user_id]=x",       // not queryable
+		"filter[title][regex]=.*", // unknown operator
+		"filter[title][$ne]=x",    // operator injection
+		"filter[$where]=1",        // field injection
+		"filter[title]x=1",        // malformed
+		"filter[title][eq][eq]=1", // malformed
+		"filter=title",            // malformed
+		"filter[type]=movie&filter[type]=series",
+		"filter[type]=movie&filter[type][eq]=series", // the same condition twice
+	} {
+		path := "/api/movies/user/" + user.ID.Hex() + "?" + query
+		if status := s.do(t, "GET", path, token, nil, nil); status != 400 {
+			t.Errorf("%s: status = %d, want 400", query, status)
+		}
+	}
+	for _, query := range []string{
+		"filter[date_visited][gte]=yesterday",
+		"filter[date_visited][contains]=2024",
+	} {
+		path := "/api/travels/user/" + user.ID.Hex() + "?" + query
+		if status := s.do(t, "GET", path, token, nil, nil); status != 400 {
+			t.Errorf("%s: status = %d, want 400", query, status)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+	_, otherToken := s.addUser(t, "Bob", "bob@example.com", models.RoleUser)
+
+	long := strings.Repeat("A slow, patient story about a family. ", 8) +
+		"I added it because of grief after my father died. " +
+		strings.Repeat("It stayed with me for years. ", 8)
+	for _, book := range []fiber.Map{
+		{"book_name": "H is for Hawk", "author": "Helen Macdonald", "reason": long},
+		{"book_name": "A Grief Observed", "author": "C. S. Lewis", "reason": "Short & honest"},
+		{"book_name": "Dune", "author": "Frank Herbert", "reason": "Sand <and> spice"},
+	} {
+		s.do(t, "POST", "/api/books", token, book, nil)
+	}
+	s.do(t, "POST", "/api/books", otherToken, fiber.Map{"book_name": "Grief Works", "reason": "grief"}, nil)
+
+	type result struct {
+		Score      float64           `json:"score"`
+		Highlights map[string]string `json:"highlights"`
+		Item       models.Book       `json:"item"`
+	}
+	var body struct {
+		Results []result `json:"results"`
+		Total   int64    `json:"total"`
+	}
+	if status := s.do(t, "GET", "/api/books/search?q=grief", token, nil, &body); status != 200 {
+		t.Fatalf("search status = %d, want 200", status)
+	}
+	if body.Total != 2 || len(body.Results) != 2 {
+		t.Fatalf("results = %+v, want the user's two books about grief", body.Results)
+	}
+	// A match in the title outweighs one in the reason
+	title, reason := body.Results[0], body.Results[1]
+	if title.Item.BookName != "A Grief Observed" || reason.Item.BookName != "H is for Hawk" || title.Score <= reason.Score {
+		t.Fatalf("order = %s (%v), %s (%v), want the title match first",
+			title.Item.BookName, title.Score, reason.Item.BookName, reason.Score)
+	}
+	if got := title.Highlights["book_name"]; got != "A <mark>Grief</mark> Observed" {
+		t.Errorf("title highlight = %q", got)
+	}
+	snippet := reason.Highlights["reason"]
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") ||
+		!strings.Contains(snippet, "because of <mark>grief</mark> after") || len(snippet) > 200 {
+		t.Errorf("reason snippet = %q, want a cut window around the match", snippet)
+	}
+
+	s.do(t, "GET", "/api/books/search?q=spice+-hawk", token, nil, &body)
+	if len(body.Results) != 1 || body.Results[0].Highlights["reason"] != "Sand &lt;and&gt; <mark>spice</mark>" {
+		t.Errorf("escaped highlight = %+v", body.Results)
+	}
+	s.do(t, "GET", "/api/books/search?q=grief+-lewis", token, nil, &body)
+	if len(body.Results) != 1 || body.Results[0].Item.BookName != "H is for Hawk" {
+		t.Errorf("excluding a word: results = %+v, want only H is for Hawk", body.Results)
+	}
+	s.do(t, "GET", "/api/books/search?q=grief&limit=1&page=2", token, nil, &body)
+	if len(body.Results) != 1 || body.Total != 2 || body.Results[0].Item.BookName != "H is for Hawk" {
+		t.Errorf("second page = %+v, want H is for Hawk", body.Results)
+	}
+
+	for _, query := range []string{"", "q=", "q=%20-", "q=grief&limit=0"} {
+		if status := s.do(t, "GET", "/api/books/search?"+query, token, nil, nil); status != 400 {
+			t.Errorf("%q: status = %d, want 400", query, status)
+		}
+	}
+
+	var travels struct {
+		Results []struct {
+			Highlights map[string]string `json:"highlights"`
+		} `json:"results"`
+	}
+	s.do(t, "POST", "/api/travels", token, fiber.Map{"place_name": "Kyoto", "reason": "Temples and gardens"}, nil)
+	s.do(t, "GET", "/api/travels/search?q=garden", token, nil, &travels)
+	if len(travels.Results) != 1 || travels.Results[0].Highlights["reason"] != "Temples and <mark>gardens</mark>" {
+		t.Errorf("stemmed travel search = %+v", travels.Results)
+	}
+}
+
+func TestLibraryViews(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+	_, otherToken := s.addUser(t, "Bob", "bob@example.com", models.RoleUser)
+
+	for _, item := range []struct {
+		collection string
+		body       fiber.Map
+	}{
+		{"books", fiber.Map{"book_name": "Ocean at the End of the Lane", "author": "Neil Gaiman", "reason": "Childhood"}},
+		{"movies", fiber.Map{"title": "Moana", "type": "movie", "reason": "The ocean songs"}},
+		{"pets", fiber.Map{"name": "Biscuit", "reason": "Loves the beach"}},
+		{"quotes", fiber.Map{"quote": "We are tiny drops in the ocean", "author": "Unknown"}},
+		{"recipes", fiber.Map{"name": "Ocean Chowder", "ingredients": "Fish, cream", "reason": "Winter"}},
+		{"travels", fiber.Map{"place_name": "Lisbon", "date_visited": "2023-05-01T00:00:00Z", "reason": "Ocean views"}},
+	} {
+		if status := s.do(t, "POST", "/api/"+item.collection, token, item.body, nil); status != 201 {
+			t.Fatalf("create %s: status = %d, want 201", item.collection, status)
+		}
+	}
+	s.do(t, "POST", "/api/books", otherToken, fiber.Map{"book_name": "Ocean"}, nil)
+
+	type hit struct {
+		Kind    string  `json:"kind"`
+		ID      string  `json:"id"`
+		Title   string  `json:"title"`
+		Snippet string  `json:"snippet"`
+		Score   float64 `json:"score"`
+	}
+	var results struct {
+		Results []hit `json:"results"`
+		Total   int64 `json:"total"`
+	}
+	if status := s.do(t, "GET", "/api/me/search?q=ocean", token, nil, &results); status != 200 {
+		t.Fatalf("search status = %d, want 200", status)
+	}
+	if results.Total != 5 || len(results.Results) != 5 {
+		t.Fatalf("results = %+v, want the five items mentioning the ocean", results.Results)
+	}
+	kinds := map[string]hit{}
+	for i, h := range results.Results {
+		kinds[h.Kind] = h
+		if i > 0 && h.Score > results.Results[i-1].Score {
+			t.Errorf("results aren't ordered by score: %+v", results.Results)
+		}
+	}
+	if h := kinds["travels"]; h.Title != "Lisbon" || h.Snippet != "<mark>Ocean</mark> views" || h.ID == "" {
+		t.Errorf("travel hit = %+v", h)
+	}
+	if h := kinds["recipes"]; h.Title != "Ocean Chowder" || h.Snippet != "<mark>Ocean</mark> Chowder" {
+		t.Errorf("recipe hit = %+v, want the snippet of the matching title", h)
+	}
+	if _, ok := kinds["pets"]; ok {
+		t.Error("the pet doesn't mention the ocean")
+	}
+
+	var second struct {
+		Results []hit `json:"results"`
+	}
+	s.do(t, "GET", "/api/me/search?q=ocean&limit=2&page=3", token, nil, &second)
+	if len(second.Results) != 1 || second.Results[0] != results.Results[4] {
+		t.Errorf("third page of two = %+v, want the fifth result", second.Results)
+	}
+
+	// An API key only searches the collections it can read
+	booksOnly := s.addAPIKey(t, user, "books:read")
+	if status := s.do(t, "GET", "/api/me/search?q=ocean", booksOnly, nil, &results); status != 200 {
+		t.Fatalf("search with an API key: status = %d, want 200", status)
+	}
+	if len(results.Results) != 1 || results.Results[0].Kind != "books" {
+		t.Errorf("books:read key results = %+v, want only the book", results.Results)
+	}
+
+	type entry struct {
+		Kind  string                 `json:"kind"`
+		Title string                 `json:"title"`
+		Item  map[string]interface{} `json:"item"`
+	}
+	var titles []string
+	path := "/api/me/feed?limit=4"
+	for pages := 0; path != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("too many feed pages")
+		}
+		var feed struct {
+			Items      []entry `json:"items"`
+			NextCursor *string `json:"next_cursor"`
+		}
+		if status := s.do(t, "GET", path, token, nil, &feed); status != 200 {
+			t.Fatalf("GET %s: status = %d, want 200", path, status)
+		}
+		for _, e := range feed.Items {
+			titles = append(titles, e.Kind+":"+e.Title)
+		}
+		path = ""
+		if feed.NextCursor != nil {
+			path = "/api/me/feed?limit=4&after=" + url.QueryEscape(*feed.NextCursor)
+		}
+	}
+	want := "travels:Lisbon recipes:Ocean Chowder quotes:We are tiny drops in the ocean pets:Biscuit " +
+		"movies:Moana books:Ocean at the End of the Lane"
+	if got := strings.Join(titles, " "); got != want {
+		t.Errorf("feed = %s, want newest first: %s", got, want)
+	}
+
+	for _, path := range []string{
+		"/api/me/search",
+		"/api/me/search?q=ocean&limit=50&page=11",
+		"/api/me/feed?limit=0",
+		"/api/me/feed?after=bogus",
+	} {
+		if status := s.do(t, "GET", path, token, nil, nil); status != 400 {
+			t.Errorf("GET %s: status = %d, want 400", path, status)
+		}
+	}
+}
+
+func TestAIPersonalityAnalysis(t *testing.T) {
+	var prompt string
+	gemini := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req controllers.GeminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Contents) == 0 || len(req.Contents[0].Parts) == 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		prompt = req.Contents[0].Parts[0].Text
+		w.Header().Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		w.Write([]byte(`{"candidates": [{"content": {"parts": [{"text": "A patient reader"}]}}]}`))
+	}))
+	defer gemini.Close()
+	t.Cleanup(controllers.SetGeminiURL(gemini.URL))
+	t.Setenv("GEMINI_API_KEY", "test")
+
+	s := newTestServer(t)
+	ada, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+	_, graceToken := s.addUser(t, "Grace", "grace@example.com", models.RoleUser)
+	s.do(t, "POST", "/api/books", token, fiber.Map{"book_name": "Dune", "reason": "Spice"}, nil)
+	s.do(t, "POST", "/api/books", graceToken, fiber.Map{"book_name": "Neuromancer"}, nil)
+
+	var analysis struct {
+		UserID              string `json:"user_id"`
+		PersonalityAnalysis string `json:"personality_analysis"`
+		DataCollected       struct {
+			Books []map[string]interface{} `json:"books"`
+		} `json:"data_collected"`
+	}
+	if status := s.do(t, "POST", "/api/aipersonality/analysis", token, nil, &analysis); status != 200 {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if analysis.UserID != ada.ID.Hex() || analysis.PersonalityAnalysis != "A patient reader" {
+		t.Fatalf("analysis = %+v", analysis)
+	}
+	if len(analysis.DataCollected.Books) != 1 || analysis.DataCollected.Books[0]["book_name"] != "Dune" {
+		t.Fatalf("books = %v, want only Dune", analysis.DataCollected.Books)
+	}
+	if !strings.Contains(prompt, "- Dune (Reason: Spice)") || strings.Contains(prompt, "Neuromancer") {
+		t.Fatalf("prompt doesn't hold just the caller's items:\n%s", prompt)
+	}
+
+	// Unverified accounts and API keys without the scope are kept out
+	unverified, _ := s.addUser(t, "Eve", "eve@example.com", models.RoleUser)
+	if _, err := s.store.Users.Update(context.Background(), unverified.ID, map[string]interface{}{"verified": false}); err != nil {
+		t.Fatal(err)
+	}
+	unverified.Verified = false
+	var problem map[string]interface{}
+	if status := s.do(t, "POST", "/api/aipersonality/analysis", s.tokenFor(t, unverified), nil, &problem); status != 403 || problem["code"] != apierror.CodeEmailNotVerified {
+		t.Fatalf("unverified: status %d, problem %v", status, problem)
+	}
+	problem = nil
+	if status := s.do(t, "POST", "/api/aipersonality/analysis", s.addAPIKey(t, ada, "books:read"), nil, &problem); status != 403 || problem["code"] != apierror.CodeInsufficientScope {
+		t.Fatalf("API key without ai:analyze: status %d, problem %v", status, problem)
+	}
+}
+
+func TestDocumentsAreIsolatedBetweenUsers(t *testing.T) {
+	s := newTestServer(t)
+	_, aliceToken := s.addUser(t, "Alice", "alice@example.com", models.RoleUser)
+	bob, bobToken := s.addUser(t, "Bob", "bob@example.com", models.RoleUser)
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	s.do(t, "POST", "/api/quotes", aliceToken, fiber.Map{"quote": "Hello"}, &created)
+
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/api/quotes/" + created.ID},
+		{"PUT", "/api/quotes/" + created.ID},
+		{"DELETE", "/api/quotes/" + created.ID},
+	} {
+		if status := s.do(t, req.method, req.path, bobToken, fiber.Map{"quote": "Mine now"}, nil); status != 404 {
+			t.Errorf("%s as another user: status = %d, want 404", req.method, status)
+		}
+	}
+
+	// Another user's listing looks the same as a user that doesn't exist
+	if status := s.do(t, "GET", "/api/quotes/user/"+bob.ID.Hex(), aliceToken, nil, nil); status != 404 {
+		t.Errorf("listing another user's quotes: status = %d, want 404", status)
+	}
+}
+
+func TestAccountRoutesRejectAPIKeys(t *testing.T) {
+	s := newTestServer(t)
+	admin, token := s.addUser(t, "Root", "root@example.com", models.RoleAdmin)
+	key := s.addAPIKey(t, admin, "books:read", "books:write")
+
+	// Account management and administration need a signed-in session
+	for _, path := range []string{"/api/users/me", "/api/users/me/apikeys", "/api/users/", "/api/admin/users"} {
+		if status := s.do(t, "GET", path, token, nil, nil); status != 200 {
+			t.Errorf("GET %s with a token: status = %d, want 200", path, status)
+		}
+		var problem map[string]interface{}
+		if status := s.do(t, "GET", path, key, nil, &problem); status != 403 || problem["code"] != apierror.CodeAPIKeyNotAllowed {
+			t.Errorf("GET %s with an API key: status = %d, code = %v, want 403 %s", path, status, problem["code"], apierror.CodeAPIKeyNotAllowed)
+		}
+	}
+
+	if status := s.do(t, "GET", "/api/books/user/"+admin.ID.Hex(), key, nil, nil); status != 200 {
+		t.Errorf("GET books with an API key: status = %d, want 200", status)
+	}
+}
+
+func TestLogoutEndsAccessTokens(t *testing.T) {
+	s := newTestServer(t)
+	user, _ := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+	s.setPassword(t, user, testPassword)
+	first := s.login(t, user.Email, testPassword)
+	second := s.login(t, user.Email, testPassword)
+
+	if status := s.do(t, "POST", "/api/users/logout", first.Token, nil, nil); status != 200 {
+		t.Fatalf("logout status = %d, want 200", status)
+	}
+
+	// The access token dies with its session, not when it expires
+	var problem map[string]interface{}
+	if status := s.do(t, "GET", "/api/users/me", first.Token, nil, &problem); status != 401 || problem["code"] != apierror.CodeInvalidToken {
+		t.Fatalf("token after logout: status %d, problem %v", status, problem)
+	}
+	if status := s.do(t, "POST", "/api/users/token/refresh", "", models.RefreshRequest{RefreshToken: first.RefreshToken}, nil); status != 401 {
+		t.Fatalf("refresh after logout: status = %d, want 401", status)
+	}
+	if status := s.do(t, "GET", "/api/users/me", second.Token, nil, nil); status != 200 {
+		t.Fatalf("other session after logout: status = %d, want 200", status)
+	}
+
+	if status := s.do(t, "POST", "/api/users/logout-all", second.Token, nil, nil); status != 200 {
+		t.Fatalf("logout-all status = %d, want 200", status)
+	}
+	if status := s.do(t, "GET", "/api/users/me", second.Token, nil, nil); status != 401 {
+		t.Fatalf("token after logout-all: status = %d, want 401", status)
+	}
+}
+
+func TestForgotPasswordIsThrottled(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	// Known and unknown addresses get the same answer, the link is mailed
+	// after it
+	for _, email := range []string{"ada@example.com", "nobody@example.com"} {
+		if status := s.do(t, "POST", "/api/users/password/forgot", "", fiber.Map{"email": email}, nil); status != 202 {
+			t.Fatalf("forgot %s: status = %d, want 202", email, status)
+		}
+	}
+	if msg := s.nextMail(t); msg.To != "ada@example.com" {
+		t.Fatalf("mail to %s, want ada@example.com", msg.To)
+	}
+	s.noMail(t)
+
+	for i := 0; i < 2; i++ {
+		s.do(t, "POST", "/api/users/password/forgot", "", fiber.Map{"email": "ADA@example.com"}, nil)
+		s.nextMail(t)
+	}
+	resp := s.request(t, "POST", "/api/users/password/forgot", "", fiber.Map{"email": "ada@example.com"})
+	resp.Body.Close()
+	if resp.StatusCode != 429 || resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Fatalf("fourth request: status %d, Retry-After %q, want 429 with Retry-After", resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+	s.noMail(t)
+}
+
+func TestSignupAndEmailVerification(t *testing.T) {
+	s := newTestServer(t)
+
+	var created map[string]interface{}
+	body := fiber.Map{"name": "Ada", "email": "Ada@Example.com", "password": testPassword}
+	if status := s.do(t, "POST", "/api/users", "", body, &created); status != 201 {
+		t.Fatalf("signup: status %d, response %v", status, created)
+	}
+	if created["email"] != "ada@example.com" || created["verified"] != false {
+		t.Fatalf("created = %v, want an unverified lowercase address", created)
+	}
+	msg := s.nextMail(t)
+	if msg.To != "ada@example.com" {
+		t.Fatalf("verification mail to %s", msg.To)
+	}
+	token := tokenFromMail(t, msg)
+
+	// The same address in any case is taken
+	for _, email := range []string{"ada@example.com", "ADA@EXAMPLE.COM"} {
+		var problem map[string]interface{}
+		body["email"] = email
+		if status := s.do(t, "POST", "/api/users", "", body, &problem); status != 409 || problem["code"] != apierror.CodeEmailTaken {
+			t.Fatalf("signup as %s: status %d, problem %v", email, status, problem)
+		}
+	}
+	s.noMail(t)
+
+	var problem map[string]interface{}
+	if status := s.do(t, "POST", "/api/users/verify-email", "", fiber.Map{"token": "not-a-token"}, &problem); status != 400 || problem["code"] != apierror.CodeInvalidToken {
+		t.Fatalf("verify with a wrong token: status %d, problem %v", status, problem)
+	}
+	if status := s.do(t, "POST", "/api/users/verify-email", "", fiber.Map{"token": token}, nil); status != 200 {
+		t.Fatalf("verify: status %d", status)
+	}
+	if status := s.do(t, "POST", "/api/users/verify-email", "", fiber.Map{"token": token}, nil); status != 400 {
+		t.Fatalf("reused verification token: status %d, want 400", status)
+	}
+
+	user, err := s.store.Users.FindByEmail(context.Background(), "ada@example.com")
+	if err != nil || !user.Verified {
+		t.Fatalf("user after verifying = %+v, %v, want verified", user, err)
+	}
+	if login := s.login(t, "ADA@example.com", testPassword); !login.Verified {
+		t.Fatal("login after verifying reports an unverified email")
+	}
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	s := newTestServer(t)
+	user, _ := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+	s.setPassword(t, user, testPassword)
+	login := s.login(t, user.Email, testPassword)
+	other := s.login(t, user.Email, testPassword)
+
+	var rotated models.TokenResponse
+	status := s.do(t, "POST", "/api/users/token/refresh", "", models.RefreshRequest{RefreshToken: login.RefreshToken}, &rotated)
+	if status != 200 || rotated.Token == "" || rotated.RefreshToken == "" || rotated.RefreshToken == login.RefreshToken {
+		t.Fatalf("refresh: status %d, response %+v, want a new refresh token", status, rotated)
+	}
+	if status := s.do(t, "GET", "/api/users/me", rotated.Token, nil, nil); status != 200 {
+		t.Fatalf("refreshed access token: status %d, want 200", status)
+	}
+
+	// Replaying the rotated token means it leaked: the whole family is
+	// revoked, so whoever refreshed with it is signed out too
+	var problem map[string]interface{}
+	if status := s.do(t, "POST", "/api/users/token/refresh", "", models.RefreshRequest{RefreshToken: login.RefreshToken}, &problem); status != 401 || problem["code"] != apierror.CodeInvalidToken {
+		t.Fatalf("replayed refresh token: status %d, problem %v", status, problem)
+	}
+	if status := s.do(t, "POST", "/api/users/token/refresh", "", models.RefreshRequest{RefreshToken: rotated.RefreshToken}, nil); status != 401 {
+		t.Fatalf("refresh token issued before the replay: status %d, want 401", status)
+	}
+	for _, token := range []string{login.Token, rotated.Token} {
+		if status := s.do(t, "GET", "/api/users/me", token, nil, nil); status != 401 {
+			t.Fatalf("access token of the revoked family: status %d, want 401", status)
+		}
+	}
+
+	// Other logins are separate families
+	if status := s.do(t, "POST", "/api/users/token/refresh", "", models.RefreshRequest{RefreshToken: other.RefreshToken}, nil); status != 200 {
+		t.Fatalf("refresh of another session: status %d, want 200", status)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	s := newTestServer(t)
+	user, _ := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+	s.setPassword(t, user, testPassword)
+	before := s.login(t, user.Email, testPassword)
+
+	if status := s.do(t, "POST", "/api/users/password/forgot", "", fiber.Map{"email": "Ada@example.com"}, nil); status != 202 {
+		t.Fatalf("forgot: status %d, want 202", status)
+	}
+	token := tokenFromMail(t, s.nextMail(t))
+
+	const newPassword = "a different horse battery"
+	if status := s.do(t, "POST", "/api/users/password/reset", "", fiber.Map{"token": token, "password": newPassword}, nil); status != 200 {
+		t.Fatalf("reset: status %d, want 200", status)
+	}
+
+	var problem map[string]interface{}
+	if status := s.do(t, "POST", "/api/users/password/reset", "", fiber.Map{"token": token, "password": testPassword}, &problem); status != 400 || problem["code"] != apierror.CodeInvalidToken {
+		t.Fatalf("reused reset token: status %d, problem %v", status, problem)
+	}
+
+	// Every session from before the reset is over
+	if status := s.do(t, "GET", "/api/users/me", before.Token, nil, nil); status != 401 {
+		t.Fatalf("access token from before the reset: status %d, want 401", status)
+	}
+	if status := s.do(t, "POST", "/api/users/token/refresh", "", models.RefreshRequest{RefreshToken: before.RefreshToken}, nil); status != 401 {
+		t.Fatalf("refresh token from before the reset: status %d, want 401", status)
+	}
+
+	if status := s.do(t, "POST", "/api/users/login", "", fiber.Map{"email": user.Email, "password": testPassword}, nil); status != 401 {
+		t.Fatalf("login with the old password: status %d, want 401", status)
+	}
+	s.login(t, user.Email, newPassword)
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t)
+	user, _ := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+	s.setPassword(t, user, testPassword)
+
+	for i := 0; i < 5; i++ {
+		if status := s.do(t, "POST", "/api/users/login", "", fiber.Map{"email": user.Email, "password": "wrong password"}, nil); status != 401 {
+			t.Fatalf("failure %d: status %d, want 401", i+1, status)
+		}
+	}
+
+	// Locked out, even with the right password and a different case
+	resp := s.request(t, "POST", "/api/users/login", "", fiber.Map{"email": "ADA@example.com", "password": testPassword})
+	resp.Body.Close()
+	retryAfter, _ := strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter))
+	if resp.StatusCode != 429 || retryAfter < 1 || retryAfter > 60 {
+		t.Fatalf("locked login: status %d, Retry-After %q, want 429 within a minute", resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+
+	// The lock is on the email, other accounts on the same IP still log in
+	grace, _ := s.addUser(t, "Grace", "grace@example.com", models.RoleUser)
+	s.setPassword(t, grace, testPassword)
+	s.login(t, grace.Email, testPassword)
+}
+
+func TestLoginUpgradesPasswordHash(t *testing.T) {
+	s := newTestServer(t)
+	user, _ := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	// A hash from before the cost was raised
+	legacy, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.Users.Update(context.Background(), user.ID, map[string]interface{}{"password": string(legacy)}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.login(t, user.Email, testPassword)
+
+	stored, err := s.store.Users.FindByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Password == string(legacy) || auth.PasswordNeedsRehash(stored.Password) {
+		t.Fatalf("hash after login = %q, want one with the current parameters", stored.Password)
+	}
+	s.login(t, user.Email, testPassword)
+}
+
+func TestProfile(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+	s.addUser(t, "Grace", "grace@example.com", models.RoleUser)
+
+	var profile map[string]interface{}
+	if status := s.do(t, "GET", "/api/users/me", token, nil, &profile); status != 200 {
+		t.Fatalf("get status = %d, want 200", status)
+	}
+	if profile["email"] != "ada@example.com" || profile["role"] != models.RoleUser {
+		t.Fatalf("profile = %v", profile)
+	}
+	if _, ok := profile["password"]; ok {
+		t.Fatal("profile includes the password")
+	}
+
+	if status := s.do(t, "PATCH", "/api/users/me", token, fiber.Map{"name": "Ada Lovelace"}, &profile); status != 200 {
+		t.Fatalf("update status = %d, want 200", status)
+	}
+	if profile["name"] != "Ada Lovelace" {
+		t.Fatalf("name = %v, want Ada Lovelace", profile["name"])
+	}
+	stored, _ := s.store.Users.FindByID(context.Background(), user.ID)
+	if stored.Name != "Ada Lovelace" {
+		t.Fatalf("stored name = %q, want Ada Lovelace", stored.Name)
+	}
+
+	if status := s.do(t, "PATCH", "/api/users/me", token, fiber.Map{"email": "GRACE@example.com"}, nil); status != 409 {
+		t.Fatalf("taken email status = %d, want 409", status)
+	}
+
+	// Invalid fields are all reported at once, like at signup
+	var problem struct {
+		Code   string             `json:"code"`
+		Errors []validation.Error `json:"errors"`
+	}
+	status := s.do(t, "PATCH", "/api/users/me", token, fiber.Map{"name": "  ", "email": "not-an-email"}, &problem)
+	want := []validation.Error{
+		{Field: "name", Code: validation.CodeRequired, Message: "name is required"},
+		{Field: "email", Code: validation.CodeInvalid, Message: "email must be a valid email address"},
+	}
+	if status != 422 || problem.Code != apierror.CodeValidationFailed || !reflect.DeepEqual(problem.Errors, want) {
+		t.Fatalf("invalid update: status %d, problem %+v", status, problem)
+	}
+	status = s.do(t, "PATCH", "/api/users/me", token, fiber.Map{"name": strings.Repeat("a", 101)}, &problem)
+	if status != 422 || len(problem.Errors) != 1 || problem.Errors[0].Code != validation.CodeTooLong {
+		t.Fatalf("long name: status %d, problem %+v", status, problem)
+	}
+	stored, _ = s.store.Users.FindByID(context.Background(), user.ID)
+	if stored.Name != "Ada Lovelace" || stored.Email != "ada@example.com" {
+		t.Fatalf("stored user = %+v, want it unchanged by invalid updates", stored)
+	}
+}
+
+func TestWeakPasswordsAreValidationErrors(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+	s.setPassword(t, user, testPassword)
+
+	// Every endpoint taking a new password reports the policy the same way
+	for _, tt := range []struct {
+		path, token string
+		body        fiber.Map
+		field       string
+	}{
+		{"/api/users", "", fiber.Map{"name": "Grace", "email": "grace@example.com", "password": "short"}, "password"},
+		{"/api/users/password/reset", "", fiber.Map{"token": "anything", "password": "short"}, "password"},
+		{"/api/users/me/password", token, fiber.Map{"current_password": testPassword, "new_password": "short"}, "new_password"},
+	} {
+		var problem struct {
+			Code   string             `json:"code"`
+			Errors []validation.Error `json:"errors"`
+		}
+		status := s.do(t, "POST", tt.path, tt.token, tt.body, &problem)
+		want := []validation.Error{{Field: tt.field, Code: validation.CodeInvalid, Message: "password must be at least 8 characters"}}
+		if status != 422 || problem.Code != apierror.CodeValidationFailed || !reflect.DeepEqual(problem.Errors, want) {
+			t.Errorf("POST %s: status %d, problem %+v", tt.path, status, problem)
+		}
+	}
+}
+
+func TestAdminRoutesRequireAdminRole(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	for _, path := range []string{"/api/admin/users", "/api/admin/audit-events"} {
+		if status := s.do(t, "GET", path, token, nil, nil); status != 403 {
+			t.Errorf("GET %s as user: status = %d, want 403", path, status)
+		}
+	}
+
+	// A demoted admin is turned away while their token is still valid, a
+	// disabled one doesn't get past authentication
+	admin, adminToken := s.addUser(t, "Root", "root@example.com", models.RoleAdmin)
+	if status := s.do(t, "GET", "/api/admin/users", adminToken, nil, nil); status != 200 {
+		t.Fatalf("GET /api/admin/users as admin: status = %d, want 200", status)
+	}
+	for _, tt := range []struct {
+		set  map[string]interface{}
+		want int
+	}{
+		{map[string]interface{}{"role": models.RoleUser}, 403},
+		{map[string]interface{}{"role": models.RoleAdmin, "disabled": true}, 401},
+	} {
+		if _, err := s.store.Users.Update(context.Background(), admin.ID, tt.set); err != nil {
+			t.Fatal(err)
+		}
+		if status := s.do(t, "GET", "/api/admin/users", adminToken, nil, nil); status != tt.want {
+			t.Errorf("GET /api/admin/users after %v: status = %d, want %d", tt.set, status, tt.want)
+		}
+	}
+}
+
+func TestAdminChangesRoleAndStatus(t *testing.T) {
+	s := newTestServer(t)
+	admin, adminToken := s.addUser(t, "Root", "root@example.com", models.RoleAdmin)
+	user, userToken := s.addUser(t, "Ada", "ada@example.com", "")
+
+	var listed struct {
+		Users []map[string]interface{} `json:"users"`
+		Total int                      `json:"total"`
+	}
+	if status := s.do(t, "GET", "/api/admin/users?q=ADA", adminToken, nil, &listed); status != 200 {
+		t.Fatalf("list status = %d, want 200", status)
+	}
+	if listed.Total != 1 || listed.Users[0]["email"] != "ada@example.com" {
+		t.Fatalf("list = %+v, want only ada", listed)
+	}
+
+	path := "/api/admin/users/" + user.ID.Hex()
+	if status := s.do(t, "PATCH", path+"/role", adminToken, fiber.Map{"role": "owner"}, nil); status != 400 {
+		t.Fatalf("invalid role status = %d, want 400", status)
+	}
+	if status := s.do(t, "PATCH", path+"/role", adminToken, fiber.Map{"role": models.RoleAdmin}, nil); status != 200 {
+		t.Fatalf("role status = %d, want 200", status)
+	}
+	if status := s.do(t, "PATCH", path+"/status", adminToken, fiber.Map{"disabled": true}, nil); status != 200 {
+		t.Fatalf("status change status = %d, want 200", status)
+	}
+	if status := s.do(t, "PATCH", "/api/admin/users/"+admin.ID.Hex()+"/role", adminToken, fiber.Map{"role": models.RoleUser}, nil); status != 400 {
+		t.Fatalf("own role status = %d, want 400", status)
+	}
+
+	stored, _ := s.store.Users.FindByID(context.Background(), user.ID)
+	if stored.Role != models.RoleAdmin || !stored.Disabled {
+		t.Fatalf("stored user = %+v, want a disabled admin", stored)
+	}
+	// Both the role change and disabling revoke the user's sessions, which
+	// ends their access token at once
+	if n := s.store.Sessions.(*repository.MemorySessionRepository).Revocations(user.ID); n != 2 {
+		t.Fatalf("session revocations = %d, want 2", n)
+	}
+	if status := s.do(t, "GET", "/api/users/me", userToken, nil, nil); status != 401 {
+		t.Fatalf("revoked token status = %d, want 401", status)
+	}
+
+	var audit struct {
+		Events []models.AuditEvent `json:"events"`
+	}
+	if status := s.do(t, "GET", "/api/admin/audit-events?action="+models.AuditUserRoleChanged, adminToken, nil, &audit); status != 200 {
+		t.Fatalf("audit status = %d, want 200", status)
+	}
+	if len(audit.Events) != 1 {
+		t.Fatalf("got %d role change events, want 1", len(audit.Events))
+	}
+	event := audit.Events[0]
+	if *event.ActorID != admin.ID || *event.UserID != user.ID ||
+		event.Before["role"] != models.RoleUser || event.After["role"] != models.RoleAdmin {
+		t.Fatalf("event = %+v", event)
+	}
+
+	// Once enabled again, the affected user sees the changes in their own
+	// activity
+	if status := s.do(t, "PATCH", path+"/status", adminToken, fiber.Map{"disabled": false}, nil); status != 200 {
+		t.Fatalf("enable status = %d, want 200", status)
+	}
+	stored, _ = s.store.Users.FindByID(context.Background(), user.ID)
+
+	var activity struct {
+		Events []models.AuditEvent `json:"events"`
+		Total  int                 `json:"total"`
+	}
+	if status := s.do(t, "GET", "/api/users/me/activity", s.tokenFor(t, stored), nil, &activity); status != 200 {
+		t.Fatalf("activity status = %d, want 200", status)
+	}
+	if activity.Total != 3 || activity.Events[1].Action != models.AuditUserStatusChanged || activity.Events[2].Action != models.AuditUserRoleChanged {
+		t.Fatalf("activity = %+v, want the status changes then the role change", activity.Events)
+	}
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+	"github.com/kashyapprajapat/collecthub_api/search"
+)
+
+const (
+	defaultLibraryPageSize = 20
+	maxLibraryPageSize     = 50
+
+	// maxLibrarySearchDepth bounds how far the merged search results can be
+	// paged, since every collection has to return that many for the merge
+	maxLibrarySearchDepth = 500
+
+	// feedOrder is the order of feed cursors, newest first
+	feedOrder = "-created_at"
+)
+
+// searchHit is a search result of any collection
+type searchHit struct {
+	Kind    string  `json:"kind"` // Collection, e.g. "books"
+	ID      string  `json:"id"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+}
+
+// feedEntry is a document of any collection on the feed
+type feedEntry struct {
+	Kind    string      `json:"kind"`
+	ID      string      `json:"id"`
+	Title   string      `json:"title"`
+	AddedAt time.Time   `json:"added_at"`
+	Item    interface{} `json:"item"`
+
+	position repository.Cursor // Created time and ID, the feed order
+}
+
+// LibraryHandler serves the views across every collection of a user. A
+// request made with an API key only sees the collections it can read.
+type LibraryHandler struct {
+	collections []CollectionResource
+}
+
+func NewLibraryHandler(collections []CollectionResource) *LibraryHandler {
+	return &LibraryHandler{collections: collections}
+}
+
+// Search ranks the authenticated user's documents of every collection by
+// relevance to ?q=, with ?page= and ?limit=
+func (h *LibraryHandler) Search(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if search.Parse(q).Empty() {
+		return apierror.BadRequest(apierror.CodeInvalidParameter, "q must contain a word to search for")
+	}
+
+	page, limit, msg := pageParams(c, defaultLibraryPageSize, maxLibraryPageSize)
+	if msg != "" {
+		return apierror.BadRequest(apierror.CodeInvalidParameter, msg)
+	}
+	depth := page * limit
+	if depth > maxLibrarySearchDepth {
+		return apierror.BadRequest(apierror.CodeInvalidParameter,
+			"only the first "+strconv.Itoa(maxLibrarySearchDepth)+" results can be paged through; refine q instead")
+	}
+
+	ownerID := auth.CurrentUserID(c)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Each collection's best depth results include every result of the
+	// requested page of the merged list
+	hits := make([][]searchHit, len(h.collections))
+	totals := make([]int64, len(h.collections))
+	err := h.fanOut(c, func(i int, r CollectionResource) error {
+		var err error
+		hits[i], totals[i], err = r.searchHits(ctx, ownerID, q, depth)
+		return err
+	})
+	if err != nil {
+		return apierror.Internal("failed to search").Wrap(err)
+	}
+
+	var merged []searchHit
+	var total int64
+	for i := range hits {
+		merged = append(merged, hits[i]...)
+		total += totals[i]
+	}
+	// Collections are in a fixed order and return hits best first, so ties
+	// keep a stable order between pages
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+
+	results := []searchHit{}
+	if start := (page - 1) * limit; start < len(merged) {
+		results = merged[start:min(start+limit, len(merged))]
+	}
+
+	return c.JSON(fiber.Map{
+		"results": results,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+	})
+}
+
+// Feed lists everything the authenticated user added, newest first, with
+// ?limit= and ?after= (the next_cursor of the previous page)
+func (h *LibraryHandler) Feed(c *fiber.Ctx) error {
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultLibraryPageSize)))
+	if err != nil || limit < 1 || limit > maxLibraryPageSize {
+		return apierror.BadRequest(apierror.CodeInvalidParameter, "limit must be between 1 and "+strconv.Itoa(maxLibraryPageSize))
+	}
+
+	var before *repository.Cursor
+	if after := c.Query("after"); after != "" {
+		var lc listCursor
+		if lc, before, err = parseCursor(after, feedOrder); err != nil {
+			return err
+		}
+		var createdAt time.Time
+		if json.Unmarshal(lc.Value, &createdAt) != nil {
+			return invalidCursor()
+		}
+		before.Value = createdAt
+	}
+
+	ownerID := auth.CurrentUserID(c)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	entries := make([][]feedEntry, len(h.collections))
+	more := make([]bool, len(h.collections))
+	err = h.fanOut(c, func(i int, r CollectionResource) error {
+		var err error
+		entries[i], more[i], err = r.recent(ctx, ownerID, before, limit)
+		return err
+	})
+	if err != nil {
+		return apierror.Internal("failed to fetch feed").Wrap(err)
+	}
+
+	merged := []feedEntry{}
+	hasMore := false
+	for i := range entries {
+		merged = append(merged, entries[i]...)
+		hasMore = hasMore || more[i]
+	}
+	// Every collection orders by creation time, then ID, so the merge does
+	sort.Slice(merged, func(i, j int) bool {
+		a, b := merged[i].position, merged[j].position
+		if at, bt := a.Value.(time.Time), b.Value.(time.Time); !at.Equal(bt) {
+			return at.After(bt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) > 0
+	})
+	if len(merged) > limit {
+		merged, hasMore = merged[:limit], true
+	}
+
+	body := fiber.Map{"items": merged, "next_cursor": nil}
+	if hasMore && len(merged) > 0 {
+		next, err := encodeCursor(feedOrder, &merged[len(merged)-1].position)
+		if err != nil {
+			return apierror.Internal("failed to encode cursor").Wrap(err)
+		}
+		body["next_cursor"] = next
+	}
+	return c.JSON(body)
+}
+
+// fanOut calls fn concurrently for every collection the request may read,
+// passing its index in h.collections, and returns the first error
+func (h *LibraryHandler) fanOut(c *fiber.Ctx, fn func(i int, r CollectionResource) error) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(h.collections))
+
+	for i, r := range h.collections {
+		if !auth.HasScope(c, r.kind()+":read") {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(i, r); err != nil {
+				errs <- fmt.Errorf("%s: %w", r.kind(), err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func (r *Resource[T]) kind() string {
+	return r.Name
+}
+
+// title is the text naming doc, its first text field
+func (r *Resource[T]) title(doc *T) string {
+	fields := repository.TextFields[r.Name]
+	if len(fields) == 0 {
+		return ""
+	}
+	title, _ := r.field(doc, fields[0].Name).Interface().(string)
+	return title
+}
+
+func (r *Resource[T]) searchHits(ctx context.Context, ownerID primitive.ObjectID, q string, limit int) ([]searchHit, int64, error) {
+	results, total, err := r.repo.Search(ctx, ownerID, q, 1, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := search.Parse(q)
+	hits := make([]searchHit, len(results))
+	for i := range results {
+		doc := &results[i].Doc
+		hits[i] = searchHit{
+			Kind:  r.Name,
+			ID:    r.field(doc, "_id").Interface().(primitive.ObjectID).Hex(),
+			Title: r.title(doc),
+			Score: results[i].Score,
+		}
+		// The snippet comes from the most telling field that matched
+		for _, field := range repository.TextFields[r.Name] {
+			text, _ := r.field(doc, field.Name).Interface().(string)
+			if hits[i].Snippet = query.Snippet(text, snippetWidth); hits[i].Snippet != "" {
+				break
+			}
+		}
+	}
+	return hits, total, nil
+}
+
+func (r *Resource[T]) recent(ctx context.Context, ownerID primitive.ObjectID, before *repository.Cursor, limit int) ([]feedEntry, bool, error) {
+	page, err := r.repo.List(ctx, ownerID, repository.ListQuery{
+		Sort:       "created_at",
+		Descending: true,
+		After:      before,
+		Limit:      limit,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	entries := make([]feedEntry, len(page.Items))
+	for i := range page.Items {
+		doc := &page.Items[i]
+		id := r.field(doc, "_id").Interface().(primitive.ObjectID)
+		createdAt := r.field(doc, "created_at").Interface().(time.Time)
+		entries[i] = feedEntry{
+			Kind:     r.Name,
+			ID:       id.Hex(),
+			Title:    r.title(doc),
+			AddedAt:  createdAt,
+			Item:     page.Items[i],
+			position: repository.Cursor{Value: createdAt, ID: id},
+		}
+	}
+	return entries, page.Next != nil, nil
+}
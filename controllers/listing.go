@@ -0,0 +1,373 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// listCursor is the content of the opaque ?after= token. It remembers the
+// order it was made for, since a position means nothing in another order.
+type listCursor struct {
+	Order string          `json:"o"`
+	Value json.RawMessage `json:"v,omitempty"`
+	ID    string          `json:"id"`
+}
+
+// filterOperators are the operators of filter[<field>][<op>]
+var filterOperators = []string{
+	repository.OpEq, repository.OpNe,
+	repository.OpGt, repository.OpGte, repository.OpLt, repository.OpLte,
+	repository.OpIn, repository.OpContains,
+}
+
+// listQuery reads the listing parameters:
+//
+//	?limit=20                     page size, at most 100
+//	?sort=-title                  id or a queryable field, descending with a leading "-"
+//	?after=...                    the next_cursor of the previous page
+//	?count=true                   also report the number of matching documents
+//	?filter[type]=series          a queryable field equals the value
+//	?filter[date_visited][gte]=   compare with one of filterOperators
+//
+// It returns the query and the normalized sort order, e.g. "-title".
+func (r *Resource[T]) listQuery(c *fiber.Ctx) (repository.ListQuery, string, error) {
+	var q repository.ListQuery
+
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultListLimit)))
+	if err != nil || limit < 1 || limit > maxListLimit {
+		return q, "", apierror.BadRequest(apierror.CodeInvalidParameter, "limit must be between 1 and "+strconv.Itoa(maxListLimit))
+	}
+	q.Limit = limit
+	q.Count = c.QueryBool("count")
+	if q.Filter, err = r.filters(c); err != nil {
+		return q, "", err
+	}
+
+	order := c.Query("sort", "id")
+	name := strings.TrimPrefix(order, "-")
+	q.Descending = name != order
+	q.Sort = "_id"
+	if name != "id" {
+		if q.Sort = r.queryField(name); q.Sort == "" {
+			return q, "", apierror.BadRequest(apierror.CodeInvalidParameter, "cannot sort "+r.Plural+" by "+strconv.Quote(name)).
+				With("sortable", append([]string{"id"}, r.queryableNames()...))
+		}
+	}
+
+	if after := c.Query("after"); after != "" {
+		if q.After, err = r.decodeCursor(after, order, q.Sort); err != nil {
+			return q, "", err
+		}
+	}
+
+	return q, order, nil
+}
+
+// queryField maps the JSON name of a queryable field to its BSON name, or
+// returns "" if lists can't be sorted or filtered by it
+func (r *Resource[T]) queryField(name string) string {
+	for _, field := range r.Queryable {
+		if r.names[field] == name {
+			return field
+		}
+	}
+	return ""
+}
+
+func (r *Resource[T]) queryableNames() []string {
+	names := make([]string, len(r.Queryable))
+	for i, field := range r.Queryable {
+		names[i] = r.names[field]
+	}
+	return names
+}
+
+// filters reads the filter[<field>] and filter[<field>][<op>] parameters.
+// Fields and operators must be on the whitelists and values are parsed
+// into the type of the field, so a value can never act as an operator. Each
+// operator can be applied to a field once.
+func (r *Resource[T]) filters(c *fiber.Ctx) ([]repository.Condition, error) {
+	var conditions []repository.Condition
+	var err error
+	seen := map[string]bool{}
+
+	c.Context().QueryArgs().VisitAll(func(k, v []byte) {
+		key := string(k)
+		if err != nil || (key != "filter" && !strings.HasPrefix(key, "filter[")) {
+			return
+		}
+
+		var condition repository.Condition
+		if condition, err = r.condition(key, string(v)); err != nil {
+			return
+		}
+		// filter[x] and filter[x][eq] are the same condition
+		pair := condition.Field + " " + condition.Op
+		if seen[pair] {
+			err = apierror.BadRequest(apierror.CodeInvalidParameter, key+" repeats a filter given before")
+			return
+		}
+		seen[pair] = true
+		conditions = append(conditions, condition)
+	})
+
+	return conditions, err
+}
+
+// condition parses one filter parameter
+func (r *Resource[T]) condition(key, raw string) (repository.Condition, error) {
+	name, op, ok := parseFilterKey(key)
+	if !ok {
+		return repository.Condition{}, apierror.BadRequest(apierror.CodeInvalidParameter,
+			strconv.Quote(key)+" is not a filter; use filter[<field>]=<value> or filter[<field>][<op>]=<value>")
+	}
+
+	field := r.queryField(name)
+	if field == "" {
+		return repository.Condition{}, apierror.BadRequest(apierror.CodeInvalidParameter, "cannot filter "+r.Plural+" by "+strconv.Quote(name)).
+			With("filterable", r.queryableNames())
+	}
+	if !slices.Contains(filterOperators, op) {
+		return repository.Condition{}, apierror.BadRequest(apierror.CodeInvalidParameter, "unknown filter operator "+strconv.Quote(op)).
+			With("operators", filterOperators)
+	}
+
+	t := r.field(new(T), field).Type()
+	if op == repository.OpContains && t.Kind() != reflect.String {
+		return repository.Condition{}, apierror.BadRequest(apierror.CodeInvalidParameter, "contains only applies to text fields, not "+name)
+	}
+
+	condition := repository.Condition{Field: field, Op: op}
+	if op == repository.OpIn {
+		var values []interface{}
+		for _, part := range strings.Split(raw, ",") {
+			value, err := parseFilterValue(key, t, part)
+			if err != nil {
+				return repository.Condition{}, err
+			}
+			values = append(values, value)
+		}
+		condition.Value = values
+		return condition, nil
+	}
+
+	value, err := parseFilterValue(key, t, raw)
+	if err != nil {
+		return repository.Condition{}, err
+	}
+	condition.Value = value
+	return condition, nil
+}
+
+// parseFilterKey splits filter[<field>] or filter[<field>][<op>], where the
+// operator defaults to eq
+func parseFilterKey(key string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(key, "filter[")
+	if !ok {
+		return "", "", false
+	}
+	name, rest, ok := strings.Cut(rest, "]")
+	if !ok || name == "" {
+		return "", "", false
+	}
+	if rest == "" {
+		return name, repository.OpEq, true
+	}
+	op, ok := strings.CutPrefix(rest, "[")
+	if !ok {
+		return "", "", false
+	}
+	op, rest, ok = strings.Cut(op, "]")
+	if !ok || rest != "" {
+		return "", "", false
+	}
+	return name, op, true
+}
+
+// parseFilterValue parses raw into a value of type t. Times are dates like
+// 2024-01-01 (midnight UTC) or RFC 3339 timestamps.
+func parseFilterValue(key string, t reflect.Type, raw string) (interface{}, error) {
+	if t == reflect.TypeOf(time.Time{}) {
+		for _, layout := range []string{time.DateOnly, time.RFC3339Nano} {
+			if value, err := time.Parse(layout, raw); err == nil {
+				return value, nil
+			}
+		}
+		return nil, apierror.BadRequest(apierror.CodeInvalidParameter, key+" must be a date like 2024-01-01 or an RFC 3339 timestamp")
+	}
+
+	value := reflect.New(t).Elem()
+	var err error
+	switch t.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(raw)
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(raw, 10, t.Bits())
+		value.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(raw, t.Bits())
+		value.SetFloat(f)
+	default:
+		return nil, apierror.BadRequest(apierror.CodeInvalidParameter, "cannot filter by "+key)
+	}
+	if err != nil {
+		return nil, apierror.BadRequest(apierror.CodeInvalidParameter, key+" must be a "+t.Kind().String())
+	}
+	return value.Interface(), nil
+}
+
+func encodeCursor(order string, cursor *repository.Cursor) (string, error) {
+	lc := listCursor{Order: order, ID: cursor.ID.Hex()}
+	if cursor.Value != nil {
+		value, err := json.Marshal(cursor.Value)
+		if err != nil {
+			return "", err
+		}
+		lc.Value = value
+	}
+	data, err := json.Marshal(lc)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor parses an ?after= token made for the given order, decoding
+// its value into the Go type of the sort field
+func (r *Resource[T]) decodeCursor(token, order, sortField string) (*repository.Cursor, error) {
+	lc, cursor, err := parseCursor(token, order)
+	if err != nil {
+		return nil, err
+	}
+	if sortField != "_id" {
+		value := reflect.New(r.field(new(T), sortField).Type())
+		if len(lc.Value) == 0 || json.Unmarshal(lc.Value, value.Interface()) != nil {
+			return nil, invalidCursor()
+		}
+		cursor.Value = value.Elem().Interface()
+	}
+	return cursor, nil
+}
+
+// parseCursor decodes an ?after= token made for the given order. The
+// returned cursor only has its ID set, since the type of the value depends
+// on the sort field.
+func parseCursor(token, order string) (listCursor, *repository.Cursor, error) {
+	var lc listCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return lc, nil, invalidCursor()
+	}
+	if err := json.Unmarshal(data, &lc); err != nil {
+		return lc, nil, invalidCursor()
+	}
+	if lc.Order != order {
+		return lc, nil, apierror.BadRequest(apierror.CodeInvalidParameter, "after is a cursor for another sort order")
+	}
+
+	cursor := &repository.Cursor{}
+	if cursor.ID, err = primitive.ObjectIDFromHex(lc.ID); err != nil {
+		return lc, nil, invalidCursor()
+	}
+	return lc, cursor, nil
+}
+
+func invalidCursor() *apierror.Error {
+	return apierror.BadRequest(apierror.CodeInvalidParameter, "after is not a valid cursor")
+}
+
+// projection parses ?fields=, a comma-separated list of the JSON fields to
+// return, into their BSON names. The ID is always returned. nil means every
+// field.
+func (r *Resource[T]) projection(param string) ([]string, error) {
+	if param == "" {
+		return nil, nil
+	}
+
+	known := map[string]string{} // JSON name -> BSON name
+	for field, name := range r.names {
+		known[name] = field
+	}
+
+	fields := []string{"_id"}
+	for _, name := range strings.Split(param, ",") {
+		field, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			var valid []string
+			for _, field := range append(slices.Clone(serverFields), r.Fields...) {
+				valid = append(valid, r.names[field])
+			}
+			return nil, apierror.BadRequest(apierror.CodeInvalidParameter, r.Plural+" have no field "+strconv.Quote(strings.TrimSpace(name))).
+				With("fields", valid)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// sendPage answers with the list envelope:
+//
+//	{"items": [...], "next_cursor": "..." or null, "total": 42}
+//
+// where total is only present when it was asked for. Items only have the
+// given BSON fields when fields isn't nil, whatever the store loaded.
+func (r *Resource[T]) sendPage(c *fiber.Ctx, page repository.Page[T], order string, fields []string, withTotal bool) error {
+	items := make([]interface{}, len(page.Items))
+	for i, doc := range page.Items {
+		items[i] = doc
+		if fields == nil {
+			continue
+		}
+
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return apierror.Internal("failed to encode " + r.Plural).Wrap(err)
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return apierror.Internal("failed to encode " + r.Plural).Wrap(err)
+		}
+		projected := map[string]json.RawMessage{}
+		for _, field := range fields {
+			if value, ok := all[r.names[field]]; ok {
+				projected[r.names[field]] = value
+			}
+		}
+		items[i] = projected
+	}
+
+	body := fiber.Map{"items": items, "next_cursor": nil}
+	if page.Next != nil {
+		next, err := encodeCursor(order, page.Next)
+		if err != nil {
+			return apierror.Internal("failed to encode cursor").Wrap(err)
+		}
+		body["next_cursor"] = next
+	}
+	if withTotal {
+		body["total"] = page.Total
+	}
+	return c.JSON(body)
+}
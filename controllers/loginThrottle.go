@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/models"
+)
+
+const (
+	// Failures allowed inside loginFailureWindow before a key is locked
+	maxFailuresPerEmail = 5
+	maxFailuresPerIP    = 20
+
+	// Failures older than this no longer count
+	loginFailureWindow = 15 * time.Minute
+
+	// The first lockout lasts loginLockoutBase and doubles with every further
+	// failure, up to loginLockoutMax
+	loginLockoutBase = time.Minute
+	loginLockoutMax  = time.Hour
+
+	// Attempt records are kept this long after the last failure
+	loginAttemptRetention = 24 * time.Hour
+
+	// Password reset emails allowed inside loginFailureWindow, locked out
+	// the same way as failed logins
+	maxResetRequestsPerEmail = 3
+	maxResetRequestsPerIP    = 10
+)
+
+func emailAttemptKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// resetRequestKey counts password reset requests apart from failed logins
+func resetRequestKey(key string) string {
+	return "reset:" + key
+}
+
+// loginRetryAfter returns how long the caller must wait before trying again,
+// or zero when neither the email nor the client IP is locked
+func (h *AuthHandler) loginRetryAfter(ctx context.Context, keys ...string) (time.Duration, error) {
+	attempts, err := h.store.LoginAttempts.FindLocked(ctx, time.Now(), keys...)
+	if err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, attempt := range attempts {
+		if d := time.Until(attempt.LockedUntil); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// retryAfterSeconds formats a wait for the Retry-After header, rounding up
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// recordLoginFailure counts a failed attempt against key and locks it once
+// it crosses maxFailures
+func (h *AuthHandler) recordLoginFailure(ctx context.Context, c *fiber.Ctx, key string, maxFailures int) error {
+	now := time.Now()
+
+	attempt, err := h.store.LoginAttempts.RecordFailure(ctx, key, now, loginFailureWindow, loginAttemptRetention)
+	if err != nil {
+		return err
+	}
+
+	if attempt.Failures < maxFailures {
+		return nil
+	}
+
+	lockedUntil := now.Add(lockoutDuration(attempt.Failures - maxFailures))
+	if err := h.store.LoginAttempts.Lock(ctx, key, lockedUntil); err != nil {
+		return err
+	}
+
+	log.Printf("🔒 Login locked for %s until %s after %d failures", key, lockedUntil.Format(time.RFC3339), attempt.Failures)
+	return h.store.LoginAttempts.InsertLockout(ctx, models.LoginLockout{
+		ID:          primitive.NewObjectID(),
+		Key:         key,
+		Failures:    attempt.Failures,
+		LockedUntil: lockedUntil,
+		IP:          c.IP(),
+		UserAgent:   c.Get(fiber.HeaderUserAgent),
+		CreatedAt:   now,
+	})
+}
+
+// lockoutDuration doubles the lockout for every failure past the threshold
+func lockoutDuration(excess int) time.Duration {
+	d := loginLockoutBase
+	for i := 0; i < excess && d < loginLockoutMax; i++ {
+		d *= 2
+	}
+	if d > loginLockoutMax {
+		d = loginLockoutMax
+	}
+	return d
+}
+
+// recordLoginFailures counts a failed login against both the email and the IP
+func (h *AuthHandler) recordLoginFailures(ctx context.Context, c *fiber.Ctx, email string) {
+	if err := h.recordLoginFailure(ctx, c, emailAttemptKey(email), maxFailuresPerEmail); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+	if err := h.recordLoginFailure(ctx, c, ipAttemptKey(c.IP()), maxFailuresPerIP); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+}
+
+// clearLoginFailures forgets failed attempts for an email after a successful
+// login. The IP counter is left alone so an attacker can't reset it by
+// logging into an account of their own.
+func (h *AuthHandler) clearLoginFailures(ctx context.Context, email string) {
+	if err := h.store.LoginAttempts.Clear(ctx, emailAttemptKey(email)); err != nil {
+		log.Printf("Failed to clear login failures: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+	"github.com/kashyapprajapat/collecthub_api/sso"
+)
+
+const (
+	oidcLoginTTL    = 10 * time.Minute
+	oidcStateCookie = "oidc_state"
+)
+
+// OIDCLogin redirects the browser to the identity provider. The state is
+// also set in a cookie so the callback only completes in the browser that
+// started the login.
+func (h *AuthHandler) OIDCLogin(c *fiber.Ctx) error {
+	state, stateHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return apierror.Internal("failed to start login").Wrap(err)
+	}
+	nonce, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		return apierror.Internal("failed to start login").Wrap(err)
+	}
+	verifier := sso.NewVerifier()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	login := models.OIDCLogin{
+		ID:           primitive.NewObjectID(),
+		StateHash:    stateHash,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(oidcLoginTTL),
+	}
+	if err := h.store.OIDCLogins.Insert(ctx, login); err != nil {
+		return apierror.Internal("failed to start login").Wrap(err)
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/users/oidc",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode, // Sent on the provider's top-level redirect back
+	})
+
+	return c.Redirect(h.provider.AuthCodeURL(state, nonce, verifier), fiber.StatusFound)
+}
+
+// OIDCCallback finishes an external sign-in. The external subject is matched
+// to a linked account, else linked to the account with the same email when
+// both the provider and the account have verified that email, else a new
+// account is created.
+func (h *AuthHandler) OIDCCallback(c *fiber.Ctx) error {
+	if errCode := c.Query("error"); errCode != "" {
+		return apierror.BadRequest(apierror.CodeIdentityProviderError, "identity provider refused the login").
+			With("provider_error", errCode).
+			With("provider_error_description", c.Query("error_description"))
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		return apierror.BadRequest(apierror.CodeMissingField, "state and code are required")
+	}
+	cookie := c.Cookies(oidcStateCookie)
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		return apierror.BadRequest(apierror.CodeInvalidToken, "login was started in a different browser, please try again")
+	}
+	c.ClearCookie(oidcStateCookie)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	// Each state can be redeemed once
+	login, err := h.store.OIDCLogins.Consume(ctx, auth.HashOpaqueToken(state), time.Now())
+	if err == repository.ErrNotFound {
+		return apierror.BadRequest(apierror.CodeInvalidToken, "invalid or expired login state")
+	}
+	if err != nil {
+		return apierror.Internal("failed to complete login").Wrap(err)
+	}
+
+	identity, err := h.provider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("OIDC exchange error: %v", err)
+		return apierror.Unauthorized(apierror.CodeIdentityProviderError, "identity provider login failed")
+	}
+
+	user, err := h.userForExternalIdentity(ctx, identity)
+	if err != nil {
+		return err
+	}
+
+	return h.beginLogin(ctx, c, user)
+}
+
+// userForExternalIdentity finds, links or creates the account for an
+// external identity. The error, an *apierror.Error, reports why that was
+// refused.
+func (h *AuthHandler) userForExternalIdentity(ctx context.Context, identity *sso.Identity) (models.User, error) {
+	user, err := h.store.Users.FindByExternalIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if err != repository.ErrNotFound {
+		return user, apierror.Internal("failed to find user").Wrap(err)
+	}
+
+	email, err := normalizeEmail(identity.Email)
+	if err != nil {
+		return user, apierror.BadRequest(apierror.CodeInvalidEmail, "identity provider did not share a valid email address")
+	}
+
+	link := models.ExternalIdentity{Issuer: identity.Issuer, Subject: identity.Subject, LinkedAt: time.Now()}
+
+	user, err = h.store.Users.FindByEmail(ctx, email)
+	if err == nil {
+		// Both sides must have proven the address. Linking on an email the
+		// provider didn't verify would let anyone who registers it there
+		// take over the account, and linking to an unverified account would
+		// hand it, and whatever password its squatter set, to the provider's
+		// user.
+		if !identity.EmailVerified || !user.Verified {
+			return user, apierror.Conflict(apierror.CodeIdentityNotLinked, "an account with this email already exists, sign in with your password first")
+		}
+		user, err = h.store.Users.LinkExternalIdentity(ctx, user.ID, link)
+		if err != nil {
+			if err == repository.ErrDuplicate {
+				return user, apierror.Conflict(apierror.CodeIdentityAlreadyLinked, "this external account is already linked")
+			}
+			return user, apierror.Internal("failed to link account").Wrap(err)
+		}
+		return user, nil
+	}
+	if err != repository.ErrNotFound {
+		return user, apierror.Internal("failed to find user").Wrap(err)
+	}
+
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	// Accounts created here have no password; one can be set through the
+	// forgot password flow
+	user = models.User{
+		ID:                 primitive.NewObjectID(),
+		Name:               name,
+		Email:              email,
+		Verified:           identity.EmailVerified,
+		Role:               models.RoleUser,
+		ExternalIdentities: []models.ExternalIdentity{link},
+	}
+	if err := h.store.Users.Insert(ctx, user); err != nil {
+		if err == repository.ErrDuplicate {
+			return user, apierror.Conflict(apierror.CodeEmailTaken, "user with this email already exists")
+		}
+		return user, apierror.Internal("failed to insert user").Wrap(err)
+	}
+
+	if !user.Verified {
+		if err := sendVerificationEmail(ctx, h.store.EmailVerifications, h.mail, user); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+		}
+	}
+
+	return user, nil
+}
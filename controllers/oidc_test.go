@@ -0,0 +1,576 @@
+package controllers_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+	"github.com/kashyapprajapat/collecthub_api/sso"
+)
+
+const testClientID = "collecthub"
+
+// mockIssuer is an OpenID Connect provider serving discovery, its signing
+// key and a token endpoint. Codes are handed out by grant instead of a
+// login page.
+type mockIssuer struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]mockGrant
+}
+
+// mockGrant is an authorization code waiting to be redeemed
+type mockGrant struct {
+	challenge string // PKCE S256 challenge sent with the authorization request
+	claims    map[string]interface{}
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, grants: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                m.srv.URL,
+			"authorization_endpoint":                m.srv.URL + "/authorize",
+			"token_endpoint":                        m.srv.URL + "/token",
+			"jwks_uri":                              m.srv.URL + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", m.token)
+
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+// provider builds the API's client for this issuer
+func (m *mockIssuer) provider(t *testing.T) *sso.Provider {
+	t.Helper()
+
+	p, err := sso.New(context.Background(), sso.Config{
+		IssuerURL:    m.srv.URL,
+		ClientID:     testClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/api/users/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	return p
+}
+
+// grant signs the user in at the provider and returns the authorization
+// code it would send back to the callback
+func (m *mockIssuer) grant(challenge string, claims map[string]interface{}) string {
+	code := primitive.NewObjectID().Hex()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.grants[code] = mockGrant{challenge: challenge, claims: claims}
+	return code
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	m.mu.Lock()
+	grant, ok := m.grants[r.PostForm.Get("code")]
+	delete(m.grants, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": m.srv.URL,
+		"aud": testClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     m.sign(claims),
+	})
+}
+
+// sign returns claims as an RS256 JWT
+func (m *mockIssuer) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// oidcLogin is what the browser carries from the login redirect
+type oidcLogin struct {
+	state, nonce, challenge string
+	cookie                  string // Value of the state cookie
+}
+
+// startOIDCLogin follows the API's redirect to the provider
+func (s *testServer) startOIDCLogin(t *testing.T) oidcLogin {
+	t.Helper()
+
+	resp := s.request(t, "GET", "/api/users/oidc/login", "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("login: status %d, want 302", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get(fiber.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := location.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+	}
+
+	login := oidcLogin{
+		state:     query.Get("state"),
+		nonce:     query.Get("nonce"),
+		challenge: query.Get("code_challenge"),
+	}
+	if login.state == "" || login.nonce == "" || login.challenge == "" {
+		t.Fatalf("redirect %s lacks state, nonce or code_challenge", location)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "oidc_state" {
+			login.cookie = cookie.Value
+		}
+	}
+	if login.cookie != login.state {
+		t.Fatalf("state cookie = %q, want the state %q", login.cookie, login.state)
+	}
+	return login
+}
+
+// oidcCallback returns to the API as the provider's redirect would
+func (s *testServer) oidcCallback(t *testing.T, state, cookie, code string, out interface{}) int {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/api/users/oidc/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: "oidc_state", Value: cookie})
+	}
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("callback: decode response: %v", err)
+	}
+	return resp.StatusCode
+}
+
+// signIn runs a whole external sign-in asserting claims
+func (s *testServer) signIn(t *testing.T, issuer *mockIssuer, claims map[string]interface{}, out interface{}) int {
+	t.Helper()
+
+	login := s.startOIDCLogin(t)
+	claims["nonce"] = login.nonce
+	return s.oidcCallback(t, login.state, login.cookie, issuer.grant(login.challenge, claims), out)
+}
+
+type oidcResult struct {
+	User models.LoginResponse `json:"user"`
+}
+
+func TestOIDCCreatesAccountOnFirstLogin(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := newTestServerWith(t, issuer.provider(t))
+
+	var first oidcResult
+	status := s.signIn(t, issuer, map[string]interface{}{
+		"sub":            "subject-1",
+		"email":          "Grace@Example.com",
+		"email_verified": true,
+		"name":           "Grace Hopper",
+	}, &first)
+	if status != 200 || first.User.Token == "" {
+		t.Fatalf("first login: status %d, result %+v", status, first)
+	}
+	if first.User.Email != "grace@example.com" || first.User.Name != "Grace Hopper" || !first.User.Verified {
+		t.Fatalf("created user = %+v", first.User)
+	}
+
+	user, err := s.store.Users.FindByExternalIdentity(context.Background(), issuer.srv.URL, "subject-1")
+	if err != nil || user.ID != first.User.ID {
+		t.Fatalf("identity lookup = %v, %v, want user %s", user.ID, err, first.User.ID)
+	}
+	if user.Password != "" {
+		t.Fatal("account created from an external identity has a password")
+	}
+
+	// The subject stays linked whatever the provider later says the email is
+	var second oidcResult
+	status = s.signIn(t, issuer, map[string]interface{}{
+		"sub":            "subject-1",
+		"email":          "grace@elsewhere.example",
+		"email_verified": false,
+	}, &second)
+	if status != 200 || second.User.ID != first.User.ID {
+		t.Fatalf("second login: status %d, user %s, want %s", status, second.User.ID, first.User.ID)
+	}
+}
+
+func TestOIDCUnverifiedEmailCreatesUnverifiedAccount(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := newTestServerWith(t, issuer.provider(t))
+
+	var result oidcResult
+	status := s.signIn(t, issuer, map[string]interface{}{
+		"sub":   "subject-1",
+		"email": "grace@example.com",
+	}, &result)
+	if status != 200 || result.User.Verified {
+		t.Fatalf("status %d, user %+v, want an unverified account", status, result.User)
+	}
+	if result.User.Name != "grace" {
+		t.Fatalf("name = %q, want the email's local part", result.User.Name)
+	}
+}
+
+func TestOIDCChecksStateAndCookie(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := newTestServerWith(t, issuer.provider(t))
+	claims := map[string]interface{}{"sub": "subject-1", "email": "grace@example.com", "email_verified": true}
+
+	login := s.startOIDCLogin(t)
+	claims["nonce"] = login.nonce
+	code := issuer.grant(login.challenge, claims)
+
+	other := s.startOIDCLogin(t)
+	for _, tt := range []struct {
+		name          string
+		state, cookie string
+	}{
+		{"no cookie", login.state, ""},
+		{"cookie from another login", login.state, other.cookie},
+		{"unknown state", "forged", "forged"},
+	} {
+		var problem map[string]interface{}
+		if status := s.oidcCallback(t, tt.state, tt.cookie, code, &problem); status != 400 || problem["code"] != apierror.CodeInvalidToken {
+			t.Errorf("%s: status %d, problem %v", tt.name, status, problem)
+		}
+	}
+
+	var result oidcResult
+	if status := s.oidcCallback(t, login.state, login.cookie, code, &result); status != 200 {
+		t.Fatalf("valid callback: status %d, result %+v", status, result)
+	}
+
+	// The state is single use, even with a fresh code
+	var problem map[string]interface{}
+	code = issuer.grant(login.challenge, claims)
+	if status := s.oidcCallback(t, login.state, login.cookie, code, &problem); status != 400 || problem["code"] != apierror.CodeInvalidToken {
+		t.Fatalf("replayed state: status %d, problem %v", status, problem)
+	}
+}
+
+func TestOIDCChecksPKCEAndNonce(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := newTestServerWith(t, issuer.provider(t))
+
+	// A code issued to another login can't be redeemed without its verifier
+	login, other := s.startOIDCLogin(t), s.startOIDCLogin(t)
+	code := issuer.grant(other.challenge, map[string]interface{}{
+		"sub": "subject-1", "email": "grace@example.com", "email_verified": true, "nonce": login.nonce,
+	})
+	var problem map[string]interface{}
+	if status := s.oidcCallback(t, login.state, login.cookie, code, &problem); status != 401 || problem["code"] != apierror.CodeIdentityProviderError {
+		t.Fatalf("wrong PKCE verifier: status %d, problem %v", status, problem)
+	}
+
+	// An ID token minted for another login is refused
+	login = s.startOIDCLogin(t)
+	code = issuer.grant(login.challenge, map[string]interface{}{
+		"sub": "subject-1", "email": "grace@example.com", "email_verified": true, "nonce": other.nonce,
+	})
+	problem = nil
+	if status := s.oidcCallback(t, login.state, login.cookie, code, &problem); status != 401 || problem["code"] != apierror.CodeIdentityProviderError {
+		t.Fatalf("wrong nonce: status %d, problem %v", status, problem)
+	}
+
+	if _, err := s.store.Users.FindByEmail(context.Background(), "grace@example.com"); err != repository.ErrNotFound {
+		t.Fatalf("FindByEmail = %v, want no account created", err)
+	}
+}
+
+func TestOIDCLinksByVerifiedEmail(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := newTestServerWith(t, issuer.provider(t))
+	existing, _ := s.addUser(t, "Grace", "grace@example.com", models.RoleUser)
+
+	var result oidcResult
+	status := s.signIn(t, issuer, map[string]interface{}{
+		"sub":            "subject-1",
+		"email":          "GRACE@example.com",
+		"email_verified": true,
+	}, &result)
+	if status != 200 || result.User.ID != existing.ID {
+		t.Fatalf("status %d, user %s, want the existing account %s", status, result.User.ID, existing.ID)
+	}
+
+	user, err := s.store.Users.FindByExternalIdentity(context.Background(), issuer.srv.URL, "subject-1")
+	if err != nil || user.ID != existing.ID {
+		t.Fatalf("identity lookup = %v, %v, want user %s", user.ID, err, existing.ID)
+	}
+}
+
+func TestOIDCRefusesToLinkUnprovenEmail(t *testing.T) {
+	issuer := newMockIssuer(t)
+
+	for _, tt := range []struct {
+		name             string
+		providerVerified bool
+		accountVerified  bool
+	}{
+		{"email unverified at the provider", false, true},
+		{"account unverified", true, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServerWith(t, issuer.provider(t))
+			existing, _ := s.addUser(t, "Grace", "grace@example.com", models.RoleUser)
+			if !tt.accountVerified {
+				if _, err := s.store.Users.Update(context.Background(), existing.ID, map[string]interface{}{"verified": false}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var problem map[string]interface{}
+			status := s.signIn(t, issuer, map[string]interface{}{
+				"sub":            "subject-1",
+				"email":          "grace@example.com",
+				"email_verified": tt.providerVerified,
+			}, &problem)
+			if status != 409 || problem["code"] != apierror.CodeIdentityNotLinked {
+				t.Fatalf("status %d, problem %v", status, problem)
+			}
+
+			user, err := s.store.Users.FindByID(context.Background(), existing.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(user.ExternalIdentities) != 0 {
+				t.Fatalf("identities = %v, want none linked", user.ExternalIdentities)
+			}
+		})
+	}
+}
+
+// racingUsers links the identity to another account between the lookup
+// by identity and the link, as a concurrent sign-in would
+type racingUsers struct {
+	repository.UserRepository
+	other primitive.ObjectID
+}
+
+func (r racingUsers) FindByExternalIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	user, err := r.UserRepository.FindByExternalIdentity(ctx, issuer, subject)
+	if err == repository.ErrNotFound {
+		r.UserRepository.LinkExternalIdentity(ctx, r.other, models.ExternalIdentity{Issuer: issuer, Subject: subject, LinkedAt: time.Now()})
+	}
+	return user, err
+}
+
+func TestOIDCAlreadyLinkedConflict(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := newTestServerWith(t, issuer.provider(t))
+	s.addUser(t, "Grace", "grace@example.com", models.RoleUser)
+	other, _ := s.addUser(t, "Other", "other@example.com", models.RoleUser)
+	s.store.Users = racingUsers{UserRepository: s.store.Users, other: other.ID}
+
+	var problem map[string]interface{}
+	status := s.signIn(t, issuer, map[string]interface{}{
+		"sub":            "subject-1",
+		"email":          "grace@example.com",
+		"email_verified": true,
+	}, &problem)
+	if status != 409 || problem["code"] != apierror.CodeIdentityAlreadyLinked {
+		t.Fatalf("status %d, problem %v", status, problem)
+	}
+}
+
+func TestOIDCProviderError(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := newTestServerWith(t, issuer.provider(t))
+
+	var problem map[string]interface{}
+	status := s.do(t, "GET", "/api/users/oidc/callback?error=access_denied&error_description=denied", "", nil, &problem)
+	if status != 400 || problem["code"] != apierror.CodeIdentityProviderError || problem["provider_error"] != "access_denied" {
+		t.Fatalf("status %d, problem %v", status, problem)
+	}
+}
+
+// passwordlessUser signs in at the provider for the first time, creating an
+// account without a password. It returns the account, a token from that
+// sign-in and one from a session that didn't just sign in.
+func (s *testServer) passwordlessUser(t *testing.T, issuer *mockIssuer) (models.User, string, string) {
+	t.Helper()
+
+	var result oidcResult
+	status := s.signIn(t, issuer, map[string]interface{}{
+		"sub":            "subject-1",
+		"email":          "grace@example.com",
+		"email_verified": true,
+	}, &result)
+	if status != 200 {
+		t.Fatalf("sign in: status %d", status)
+	}
+
+	user, err := s.store.Users.FindByID(context.Background(), result.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, result.User.Token, s.tokenFor(t, user)
+}
+
+func TestPasswordlessAccountSetsFirstPassword(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := newTestServerWith(t, issuer.provider(t))
+	user, fresh, stale := s.passwordlessUser(t, issuer)
+	body := map[string]string{"new_password": testPassword}
+
+	var problem map[string]interface{}
+	if status := s.do(t, "POST", "/api/users/me/password", stale, body, &problem); status != 401 || problem["code"] != apierror.CodeReauthRequired {
+		t.Fatalf("without a recent sign-in: status %d, problem %v", status, problem)
+	}
+	if status := s.do(t, "POST", "/api/users/me/password", fresh, body, nil); status != 200 {
+		t.Fatalf("set password: status %d", status)
+	}
+	login := s.login(t, user.Email, testPassword)
+
+	// Refreshing keeps the time of the sign-in that started the session
+	var refreshed models.TokenResponse
+	s.do(t, "POST", "/api/users/token/refresh", "", models.RefreshRequest{RefreshToken: login.RefreshToken}, &refreshed)
+	first, err := auth.ParseAccessToken(login.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := auth.ParseAccessToken(refreshed.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.AuthTime == nil || second.AuthTime == nil || !second.AuthTime.Equal(first.AuthTime.Time) {
+		t.Fatalf("auth_time %v after refresh, want %v", second.AuthTime, first.AuthTime)
+	}
+
+	// Once set, the password is needed to change it
+	problem = nil
+	body["new_password"] = "another correct horse"
+	if status := s.do(t, "POST", "/api/users/me/password", refreshed.Token, body, &problem); status != 400 || problem["code"] != apierror.CodeMissingField {
+		t.Fatalf("without current_password: status %d, problem %v", status, problem)
+	}
+}
+
+func TestPasswordlessAccountDeletesWithRecentSignIn(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := newTestServerWith(t, issuer.provider(t))
+	user, fresh, stale := s.passwordlessUser(t, issuer)
+
+	var problem map[string]interface{}
+	if status := s.do(t, "DELETE", "/api/users/me", stale, map[string]string{}, &problem); status != 401 || problem["code"] != apierror.CodeReauthRequired {
+		t.Fatalf("without a recent sign-in: status %d, problem %v", status, problem)
+	}
+	if status := s.do(t, "DELETE", "/api/users/me", fresh, map[string]string{}, nil); status != 200 {
+		t.Fatalf("delete: status %d", status)
+	}
+	if _, err := s.store.Users.FindByID(context.Background(), user.ID); err != repository.ErrNotFound {
+		t.Fatalf("user lookup after delete: %v, want not found", err)
+	}
+}
+
+func TestPasswordlessAccountDisablesTwoFactorWithRecentSignIn(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := newTestServerWith(t, issuer.provider(t))
+	clock := newStepClock(t)
+	_, fresh, stale := s.passwordlessUser(t, issuer)
+
+	var setup struct {
+		Secret string `json:"secret"`
+	}
+	s.do(t, "POST", "/api/users/me/2fa/setup", fresh, nil, &setup)
+	verify := models.TwoFactorCodeRequest{Code: totpCode(t, setup.Secret, clock.step())}
+	if status := s.do(t, "POST", "/api/users/me/2fa/verify", fresh, verify, nil); status != 200 {
+		t.Fatalf("verify: status %d", status)
+	}
+
+	var problem map[string]interface{}
+	body := models.DisableTwoFactorRequest{Code: totpCode(t, setup.Secret, clock.step()+1)}
+	if status := s.do(t, "POST", "/api/users/me/2fa/disable", stale, body, &problem); status != 401 || problem["code"] != apierror.CodeReauthRequired {
+		t.Fatalf("without a recent sign-in: status %d, problem %v", status, problem)
+	}
+	if status := s.do(t, "POST", "/api/users/me/2fa/disable", fresh, body, nil); status != 200 {
+		t.Fatalf("disable: status %d", status)
+	}
+}
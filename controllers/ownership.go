@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/auth"
+)
+
+// isCurrentUser reports whether the :userId path parameter refers to the
+// authenticated user
+func isCurrentUser(c *fiber.Ctx, userID primitive.ObjectID) bool {
+	return userID == auth.CurrentUserID(c)
+}
+
+// snapshot converts a document to the BSON form stored in audit events
+func snapshot(doc interface{}) bson.M {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil
+	}
+	var m bson.M
+	if err := bson.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/mailer"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+	"github.com/kashyapprajapat/collecthub_api/validation"
+)
+
+const passwordResetTTL = time.Hour
+
+// appBaseURL is the public URL of the frontend that links in emails point to
+func appBaseURL() string {
+	if url := os.Getenv("APP_BASE_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:" + os.Getenv("PORT")
+}
+
+// ForgotPassword mails a single-use reset link. The response is the same
+// whether or not the email belongs to an account, and the account is looked
+// up and mailed after responding, so addresses can't be probed by the answer
+// or by how long it takes.
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req models.ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+	if req.Email == "" {
+		return apierror.BadRequest(apierror.CodeMissingField, "email is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Every request counts, for known and unknown addresses alike, so the
+	// limit says nothing about which exist
+	emailKey, ipKey := resetRequestKey(emailAttemptKey(req.Email)), resetRequestKey(ipAttemptKey(c.IP()))
+	retryAfter, err := h.loginRetryAfter(ctx, emailKey, ipKey)
+	if err != nil {
+		return apierror.Internal("failed to check reset requests").Wrap(err)
+	}
+	if retryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, retryAfterSeconds(retryAfter))
+		return apierror.TooManyRequests("too many password reset requests, try again later")
+	}
+	if err := h.recordLoginFailure(ctx, c, emailKey, maxResetRequestsPerEmail); err != nil {
+		log.Printf("Failed to record reset request: %v", err)
+	}
+	if err := h.recordLoginFailure(ctx, c, ipKey, maxResetRequestsPerIP); err != nil {
+		log.Printf("Failed to record reset request: %v", err)
+	}
+
+	go h.sendPasswordReset(req.Email)
+
+	return c.Status(202).JSON(fiber.Map{"message": "if an account exists for this email, a reset link has been sent"})
+}
+
+// sendPasswordReset mails a reset link when email belongs to an account. It
+// runs after ForgotPassword has answered, so failures are only logged.
+func (h *AuthHandler) sendPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	user, err := h.store.Users.FindByEmail(ctx, email)
+	if err == repository.ErrNotFound {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to find user for password reset: %v", err)
+		return
+	}
+
+	// Only the most recent link works
+	if _, err := h.store.PasswordResets.DeleteByUser(ctx, user.ID); err != nil {
+		log.Printf("Failed to create reset token: %v", err)
+		return
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		log.Printf("Failed to create reset token: %v", err)
+		return
+	}
+
+	now := time.Now()
+	reset := models.PasswordReset{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(passwordResetTTL),
+	}
+	if err := h.store.PasswordResets.Insert(ctx, reset); err != nil {
+		log.Printf("Failed to create reset token: %v", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", appBaseURL(), token)
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your CollectHub password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.",
+			user.Name, passwordResetTTL, link,
+		),
+	}
+	if err := h.mail.Send(ctx, msg); err != nil {
+		log.Printf("Failed to send password reset email: %v", err)
+	}
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out of every existing session
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var req models.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+	if req.Token == "" || req.Password == "" {
+		return apierror.BadRequest(apierror.CodeMissingField, "token and password are required")
+	}
+	if err := auth.CheckPasswordPolicy(req.Password); err != nil {
+		var errs validation.Errors
+		errs.Add("password", validation.CodeInvalid, err.Error())
+		return apierror.Validation(errs)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Tokens are too long to guess, but wrong ones still share the login
+	// limit for the client's IP
+	ipKey := ipAttemptKey(c.IP())
+	retryAfter, err := h.loginRetryAfter(ctx, ipKey)
+	if err != nil {
+		return apierror.Internal("failed to check reset attempts").Wrap(err)
+	}
+	if retryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, retryAfterSeconds(retryAfter))
+		return apierror.TooManyRequests("too many failed attempts, try again later")
+	}
+
+	// Consume the token atomically so it can only ever be used once
+	reset, err := h.store.PasswordResets.Consume(ctx, auth.HashOpaqueToken(req.Token), time.Now())
+	if err == repository.ErrNotFound {
+		if err := h.recordLoginFailure(ctx, c, ipKey, maxFailuresPerIP); err != nil {
+			log.Printf("Failed to record reset failure: %v", err)
+		}
+		return apierror.BadRequest(apierror.CodeInvalidToken, "invalid or expired reset token")
+	}
+	if err != nil {
+		return apierror.Internal("failed to reset password").Wrap(err)
+	}
+
+	hashedPassword, err := HashPassword(req.Password)
+	if err != nil {
+		return apierror.Internal("failed to hash password").Wrap(err)
+	}
+
+	if _, err := h.store.Users.Update(ctx, reset.UserID, map[string]interface{}{"password": hashedPassword}); err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.BadRequest(apierror.CodeInvalidToken, "invalid or expired reset token")
+		}
+		return apierror.Internal("failed to reset password").Wrap(err)
+	}
+
+	if _, err := h.store.Sessions.RevokeAll(ctx, reset.UserID); err != nil {
+		log.Printf("Failed to revoke sessions after password reset: %v", err)
+	}
+
+	recordAuditTo(c, h.store.Audit, models.AuditEvent{
+		Action:     models.AuditPasswordReset,
+		UserID:     &reset.UserID,
+		TargetType: "user",
+		TargetID:   &reset.UserID,
+	})
+
+	return c.JSON(fiber.Map{"message": "password reset successfully"})
+}
@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/mailer"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+	"github.com/kashyapprajapat/collecthub_api/validation"
+)
+
+// userProfile is the public view of a user, never including the password hash
+func userProfile(user models.User) fiber.Map {
+	return fiber.Map{
+		"id":       user.ID,
+		"name":     user.Name,
+		"email":    user.Email,
+		"verified": user.Verified,
+		"role":     user.EffectiveRole(),
+	}
+}
+
+// ProfileHandler serves the authenticated user's own account
+type ProfileHandler struct {
+	store *repository.Store
+	mail  mailer.Mailer
+}
+
+func NewProfileHandler(store *repository.Store, mail mailer.Mailer) *ProfileHandler {
+	return &ProfileHandler{store: store, mail: mail}
+}
+
+// GetMe returns the authenticated user's profile
+func (h *ProfileHandler) GetMe(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := h.store.Users.FindByID(ctx, auth.CurrentUserID(c))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.NotFound("user not found")
+		}
+		return apierror.Internal("failed to fetch user").Wrap(err)
+	}
+
+	return c.JSON(userProfile(user))
+}
+
+// UpdateMe changes the authenticated user's name and/or email. A new email
+// must be verified again.
+func (h *ProfileHandler) UpdateMe(c *fiber.Ctx) error {
+	var req models.UpdateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+
+	// Report every invalid field at once, in the same shape as signup
+	errs := validation.Struct(&req)
+	var email string
+	if req.Email != nil && strings.TrimSpace(*req.Email) != "" {
+		var err error
+		if email, err = normalizeEmail(*req.Email); err != nil {
+			errs.Add("email", validation.CodeInvalid, "email must be a valid email address")
+		}
+	}
+	if len(errs) > 0 {
+		return apierror.Validation(errs)
+	}
+
+	update := map[string]interface{}{}
+	if req.Name != nil {
+		update["name"] = strings.TrimSpace(*req.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.store.Users.FindByID(ctx, auth.CurrentUserID(c))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.NotFound("user not found")
+		}
+		return apierror.Internal("failed to fetch user").Wrap(err)
+	}
+
+	emailChanged := false
+	if req.Email != nil && email != user.Email {
+		update["email"] = email
+		update["verified"] = false
+		emailChanged = true
+	}
+
+	if len(update) == 0 {
+		return apierror.BadRequest(apierror.CodeNoChanges, "no fields to update")
+	}
+
+	if _, err := h.store.Users.Update(ctx, user.ID, update); err != nil {
+		if err == repository.ErrDuplicate {
+			return apierror.Conflict(apierror.CodeEmailTaken, "user with this email already exists")
+		}
+		if err == repository.ErrNotFound {
+			return apierror.NotFound("user not found")
+		}
+		return apierror.Internal("failed to update user").Wrap(err)
+	}
+
+	if name, ok := update["name"].(string); ok {
+		user.Name = name
+	}
+	if emailChanged {
+		user.Email = update["email"].(string)
+		user.Verified = false
+		if err := sendVerificationEmail(ctx, h.store.EmailVerifications, h.mail, user); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+		}
+	}
+
+	return c.JSON(userProfile(user))
+}
+
+// ChangePassword replaces the password after checking the current one and
+// signs out every other session
+func (h *ProfileHandler) ChangePassword(c *fiber.Ctx) error {
+	var req models.ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+	if req.NewPassword == "" {
+		return apierror.BadRequest(apierror.CodeMissingField, "new_password is required")
+	}
+	if err := auth.CheckPasswordPolicy(req.NewPassword); err != nil {
+		var errs validation.Errors
+		errs.Add("new_password", validation.CodeInvalid, err.Error())
+		return apierror.Validation(errs)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.store.Users.FindByID(ctx, auth.CurrentUserID(c))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.NotFound("user not found")
+		}
+		return apierror.Internal("failed to fetch user").Wrap(err)
+	}
+
+	// Accounts created by an external sign-in set their first password here
+	if err := confirmIdentity(c, user, req.CurrentPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := HashPassword(req.NewPassword)
+	if err != nil {
+		return apierror.Internal("failed to hash password").Wrap(err)
+	}
+
+	if _, err := h.store.Users.Update(ctx, user.ID, map[string]interface{}{"password": hashedPassword}); err != nil {
+		return apierror.Internal("failed to update password").Wrap(err)
+	}
+
+	// Keep this device signed in, sign out everywhere else
+	familyID, _ := primitive.ObjectIDFromHex(auth.CurrentClaims(c).SessionID)
+	if _, err := h.store.Sessions.RevokeOthers(ctx, user.ID, familyID); err != nil {
+		log.Printf("Failed to revoke sessions after password change: %v", err)
+	}
+
+	recordAuditTo(c, h.store.Audit, models.AuditEvent{
+		Action:     models.AuditPasswordChanged,
+		UserID:     &user.ID,
+		TargetType: "user",
+		TargetID:   &user.ID,
+	})
+
+	return c.JSON(fiber.Map{"message": "password changed successfully"})
+}
+
+// DeleteMe permanently deletes the authenticated user and everything they
+// saved, reporting how many documents were removed from each collection
+func (h *ProfileHandler) DeleteMe(c *fiber.Ctx) error {
+	var req models.DeleteAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	user, err := h.store.Users.FindByID(ctx, auth.CurrentUserID(c))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.NotFound("user not found")
+		}
+		return apierror.Internal("failed to fetch user").Wrap(err)
+	}
+
+	if err := confirmIdentity(c, user, req.Password); err != nil {
+		return err
+	}
+
+	deleted, err := h.store.DeleteUser(ctx, user.ID)
+	if err != nil {
+		return apierror.Internal("failed to delete account").Wrap(err)
+	}
+
+	counts := bson.M{}
+	for name, n := range deleted {
+		counts[name] = n
+	}
+	recordAuditTo(c, h.store.Audit, models.AuditEvent{
+		Action:     models.AuditAccountDeleted,
+		UserID:     &user.ID,
+		TargetType: "user",
+		TargetID:   &user.ID,
+		Before:     bson.M{"name": user.Name, "email": user.Email, "role": user.EffectiveRole()},
+		Details:    bson.M{"deleted": counts},
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "account deleted successfully",
+		"deleted": deleted,
+	})
+}
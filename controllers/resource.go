@@ -0,0 +1,405 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/middleware"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/patch"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+	"github.com/kashyapprajapat/collecthub_api/validation"
+)
+
+// Resource serves the CRUD routes of one user-owned collection whose
+// documents are stored as T. T must have the serverFields, which are always
+// set by the server; clients can only write Fields. The rules for each field
+// are declared in T's validate tags.
+type Resource[T any] struct {
+	Name      string   // Collection name and route segment, e.g. "books"
+	Singular  string   // Used in messages, e.g. "book"
+	Plural    string   // Used in messages, e.g. "books"
+	Fields    []string // BSON names of the fields clients can write
+	Queryable []string // BSON names of the Fields lists can be sorted and filtered by, besides the timestamps
+
+	// Defaults fills in values the client left out of a new document, or
+	// cleared with an update
+	Defaults func(doc *T)
+
+	repo  repository.Repository[T]
+	audit repository.AuditLog
+	index map[string][]int  // BSON name -> struct field index
+	names map[string]string // BSON name -> JSON name
+}
+
+// serverFields are the BSON fields of every document that only the server
+// writes: the ID, the owner, the timestamps and the version, which is also
+// the document's ETag
+var serverFields = []string{"_id", "user_id", "created_at", "updated_at", "version"}
+
+// CollectionResource is the part of a Resource that doesn't depend on its
+// document type, so resources of different types can be listed together
+type CollectionResource interface {
+	Register(router fiber.Router)
+
+	// Used by the cross-collection views of LibraryHandler
+	kind() string
+	searchHits(ctx context.Context, ownerID primitive.ObjectID, q string, limit int) ([]searchHit, int64, error)
+	recent(ctx context.Context, ownerID primitive.ObjectID, before *repository.Cursor, limit int) ([]feedEntry, bool, error)
+}
+
+// NewResource binds a resource definition to the repository its documents
+// are stored in. It panics when Fields don't match T, which is a
+// programming error.
+func NewResource[T any](def Resource[T], repo repository.Repository[T], audit repository.AuditLog) *Resource[T] {
+	r := def
+	r.repo = repo
+	r.audit = audit
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	r.index = repository.FieldIndex(t)
+	r.names = map[string]string{}
+	for _, name := range append(slices.Clone(serverFields), r.Fields...) {
+		if _, ok := r.index[name]; !ok {
+			panic(fmt.Sprintf("resource %s: %T has no %q field", r.Name, *new(T), name))
+		}
+		r.names[name] = validation.JSONName(t.FieldByIndex(r.index[name]))
+	}
+	for _, name := range r.Queryable {
+		if !slices.Contains(r.Fields, name) {
+			panic(fmt.Sprintf("resource %s: queryable field %q is not one of its fields", r.Name, name))
+		}
+	}
+	r.Queryable = append(slices.Clone(r.Queryable), "created_at", "updated_at")
+	for _, field := range repository.TextFields[r.Name] {
+		if !slices.Contains(r.Fields, field.Name) {
+			panic(fmt.Sprintf("resource %s: text field %q is not one of its fields", r.Name, field.Name))
+		}
+	}
+	return &r
+}
+
+// Register adds the resource's routes, guarded by the <name>:read and
+// <name>:write API key scopes
+func (r *Resource[T]) Register(router fiber.Router) {
+	read := middleware.RequireScope(r.Name + ":read")
+	write := middleware.RequireScope(r.Name + ":write")
+
+	router.Post("/"+r.Name, write, r.Create)
+	router.Get("/"+r.Name+"/user/:userId", read, r.ListByUser)
+	router.Get("/"+r.Name+"/search", read, r.Search)
+	router.Get("/"+r.Name+"/:id", read, r.Get)
+	router.Put("/"+r.Name+"/:id", write, r.Replace)
+	router.Patch("/"+r.Name+"/:id", write, r.Patch)
+	router.Delete("/"+r.Name+"/:id", write, r.Delete)
+}
+
+// Create stores a new document owned by the authenticated user and answers
+// 201 with the stored document and its URL in the Location header
+func (r *Resource[T]) Create(c *fiber.Ctx) error {
+	var doc T
+	if err := c.BodyParser(&doc); err != nil {
+		return apierror.InvalidBody()
+	}
+
+	if r.Defaults != nil {
+		r.Defaults(&doc)
+	}
+	if errs := validation.Struct(&doc); len(errs) > 0 {
+		return apierror.Validation(errs)
+	}
+
+	// The server fields always come from the server, never from the body.
+	// MongoDB keeps milliseconds, so the response matches later reads.
+	now := time.Now().Truncate(time.Millisecond)
+	r.field(&doc, "_id").Set(reflect.ValueOf(primitive.NewObjectID()))
+	r.field(&doc, "user_id").Set(reflect.ValueOf(auth.CurrentUserID(c)))
+	r.field(&doc, "created_at").Set(reflect.ValueOf(now))
+	r.field(&doc, "updated_at").Set(reflect.ValueOf(now))
+	r.field(&doc, "version").SetInt(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := r.repo.Insert(ctx, doc); err != nil {
+		return apierror.Internal("failed to insert " + r.Singular).Wrap(err)
+	}
+
+	id := r.field(&doc, "_id").Interface().(primitive.ObjectID)
+	c.Location(strings.TrimSuffix(c.Path(), "/") + "/" + id.Hex())
+	c.Set(fiber.HeaderETag, r.etag(&doc))
+	return c.Status(201).JSON(doc)
+}
+
+// ListByUser returns a page of the documents of the user in :userId, which
+// must be the authenticated user. See listQuery for the parameters.
+func (r *Resource[T]) ListByUser(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidID, "invalid user ID")
+	}
+
+	if !isCurrentUser(c, objID) {
+		return apierror.NotFound("user not found")
+	}
+
+	query, order, err := r.listQuery(c)
+	if err != nil {
+		return err
+	}
+	if query.Fields, err = r.projection(c.Query("fields")); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	page, err := r.repo.List(ctx, objID, query)
+	if err != nil {
+		return apierror.Internal("failed to fetch " + r.Plural).Wrap(err)
+	}
+
+	return r.sendPage(c, page, order, query.Fields, query.Count)
+}
+
+// Get returns one of the authenticated user's documents with its ETag, or
+// 304 when it still matches If-None-Match
+func (r *Resource[T]) Get(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidID, "invalid "+r.Singular+" ID")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	doc, err := r.repo.FindOwned(ctx, objID, auth.CurrentUserID(c))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.NotFound(r.Singular + " not found")
+		}
+		return apierror.Internal("failed to fetch " + r.Singular).Wrap(err)
+	}
+
+	c.Set(fiber.HeaderETag, r.etag(&doc))
+	if c.Fresh() {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	return c.JSON(doc)
+}
+
+// Replace stores the request body as the whole new document, so fields
+// left out are cleared
+func (r *Resource[T]) Replace(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidID, "invalid "+r.Singular+" ID")
+	}
+
+	var doc T
+	if err := c.BodyParser(&doc); err != nil {
+		return apierror.InvalidBody()
+	}
+
+	current, err := r.current(c, objID)
+	if err != nil {
+		return err
+	}
+	return r.save(c, current, doc)
+}
+
+// Patch changes part of a document. The body is a JSON Merge Patch
+// (RFC 7396), where null clears a field, or with the
+// application/json-patch+json content type a JSON Patch (RFC 6902).
+func (r *Resource[T]) Patch(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidID, "invalid "+r.Singular+" ID")
+	}
+
+	apply := patch.Merge
+	mediaType, _, _ := strings.Cut(c.Get(fiber.HeaderContentType), ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case patch.MergePatchContentType, fiber.MIMEApplicationJSON:
+	case patch.JSONPatchContentType:
+		apply = patch.Apply
+	default:
+		return apierror.New(fiber.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType,
+			"use "+patch.MergePatchContentType+" or "+patch.JSONPatchContentType).
+			With("accept_patch", []string{patch.MergePatchContentType, patch.JSONPatchContentType})
+	}
+
+	current, err := r.current(c, objID)
+	if err != nil {
+		return err
+	}
+
+	original, err := json.Marshal(current)
+	if err != nil {
+		return apierror.Internal("failed to encode " + r.Singular).Wrap(err)
+	}
+	patched, err := apply(original, c.Body())
+	if errors.Is(err, patch.ErrTestFailed) {
+		return apierror.Conflict(apierror.CodePatchTestFailed, err.Error())
+	}
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidPatch, err.Error())
+	}
+
+	var doc T
+	if err := json.Unmarshal(patched, &doc); err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidPatch, "patched "+r.Singular+" is invalid: "+err.Error())
+	}
+
+	return r.save(c, current, doc)
+}
+
+// current fetches the authenticated user's document objID for a change,
+// which the If-Match header must allow
+func (r *Resource[T]) current(c *fiber.Ctx, objID primitive.ObjectID) (T, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	doc, err := r.repo.FindOwned(ctx, objID, auth.CurrentUserID(c))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return doc, apierror.NotFound(r.Singular + " not found")
+		}
+		return doc, apierror.Internal("failed to fetch " + r.Singular).Wrap(err)
+	}
+
+	if !ifMatch(c, r.etag(&doc)) {
+		return doc, r.changed(c)
+	}
+	return doc, nil
+}
+
+// save fills in defaults, validates doc and stores it in place of current,
+// keeping the ID, owner and creation time and moving to the next version,
+// then answers with the stored document
+func (r *Resource[T]) save(c *fiber.Ctx, current, doc T) error {
+	if r.Defaults != nil {
+		r.Defaults(&doc)
+	}
+	if errs := validation.Struct(&doc); len(errs) > 0 {
+		return apierror.Validation(errs)
+	}
+
+	for _, name := range []string{"_id", "user_id", "created_at"} {
+		r.field(&doc, name).Set(r.field(&current, name))
+	}
+	version := r.field(&current, "version").Int()
+	r.field(&doc, "updated_at").Set(reflect.ValueOf(time.Now().Truncate(time.Millisecond)))
+	r.field(&doc, "version").SetInt(version + 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objID := r.field(&doc, "_id").Interface().(primitive.ObjectID)
+	err := r.repo.ReplaceOwned(ctx, objID, auth.CurrentUserID(c), version, doc)
+	if err == repository.ErrNotFound {
+		return apierror.NotFound(r.Singular + " not found")
+	}
+	if err == repository.ErrVersionConflict {
+		return r.changed(c)
+	}
+	if err != nil {
+		return apierror.Internal("failed to update " + r.Singular).Wrap(err)
+	}
+
+	c.Set(fiber.HeaderETag, r.etag(&doc))
+	return c.JSON(doc)
+}
+
+// Delete removes one of the authenticated user's documents, provided the
+// If-Match header, when given, matches it
+func (r *Resource[T]) Delete(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidID, "invalid "+r.Singular+" ID")
+	}
+
+	version := repository.AnyVersion
+	if c.Get(fiber.HeaderIfMatch) != "" {
+		current, err := r.current(c, objID)
+		if err != nil {
+			return err
+		}
+		version = r.field(&current, "version").Int()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := r.repo.DeleteOwned(ctx, objID, auth.CurrentUserID(c), version)
+	if err == repository.ErrNotFound {
+		return apierror.NotFound(r.Singular + " not found")
+	}
+	if err == repository.ErrVersionConflict {
+		return r.changed(c)
+	}
+	if err != nil {
+		return apierror.Internal("failed to delete " + r.Singular).Wrap(err)
+	}
+
+	recordAuditTo(c, r.audit, models.AuditEvent{
+		Action:     models.AuditItemDeleted,
+		UserID:     objectIDRef(auth.CurrentUserID(c)),
+		TargetType: r.Name,
+		TargetID:   &objID,
+		Before:     snapshot(deleted),
+	})
+
+	return c.JSON(fiber.Map{
+		"message":       r.Singular + " deleted successfully",
+		"deleted_count": 1,
+	})
+}
+
+// etag is the entity tag of doc, its quoted version
+func (r *Resource[T]) etag(doc *T) string {
+	return `"` + strconv.FormatInt(r.field(doc, "version").Int(), 10) + `"`
+}
+
+// changed reports that the document was changed by someone else: since the
+// client read it when it sent If-Match, or else while this request was
+// updating it
+func (r *Resource[T]) changed(c *fiber.Ctx) error {
+	if c.Get(fiber.HeaderIfMatch) != "" {
+		return apierror.New(fiber.StatusPreconditionFailed, apierror.CodePreconditionFailed,
+			"the "+r.Singular+" has changed; fetch it again to get its current ETag")
+	}
+	return apierror.Conflict(apierror.CodeEditConflict, "the "+r.Singular+" was changed by another request; try again")
+}
+
+// ifMatch reports whether the If-Match header allows changing a document
+// with the given ETag. Matching is strong, so weak tags never match, and a
+// missing header allows anything.
+func ifMatch(c *fiber.Ctx, etag string) bool {
+	header := c.Get(fiber.HeaderIfMatch)
+	if header == "" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// field returns the struct field of doc stored under the given BSON name
+func (r *Resource[T]) field(doc *T, name string) reflect.Value {
+	return reflect.ValueOf(doc).Elem().FieldByIndex(r.index[name])
+}
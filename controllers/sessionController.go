@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+)
+
+// issueTokens stores a new refresh token in the given family and signs a
+// matching access token. authTime is when the user signed in to start the
+// family.
+func (h *AuthHandler) issueTokens(ctx context.Context, c *fiber.Ctx, user models.User, familyID primitive.ObjectID, authTime time.Time) (*models.TokenResponse, error) {
+	refreshToken, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		IP:        c.IP(),
+		AuthTime:  authTime,
+		CreatedAt: now,
+		ExpiresAt: now.Add(auth.RefreshTTL()),
+	}
+	if err := h.store.Sessions.Insert(ctx, session); err != nil {
+		return nil, err
+	}
+
+	token, expiresAt, err := auth.IssueAccessToken(auth.Identity{
+		UserID:        user.ID,
+		Email:         user.Email,
+		EmailVerified: user.Verified,
+		Role:          user.EffectiveRole(),
+		SessionID:     familyID.Hex(),
+		AuthTime:      authTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// RefreshAccessToken exchanges a refresh token for a new access token and a
+// new refresh token. The presented refresh token can never be used again.
+func (h *AuthHandler) RefreshAccessToken(c *fiber.Ctx) error {
+	var req models.RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+	if req.RefreshToken == "" {
+		return apierror.BadRequest(apierror.CodeMissingField, "refresh_token is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hash := auth.HashOpaqueToken(req.RefreshToken)
+
+	// Claim the token atomically so two concurrent refreshes can't both rotate it
+	session, err := h.store.Sessions.Claim(ctx, hash, time.Now())
+	if err == repository.ErrNotFound {
+		// A token that was already rotated is being replayed, so someone else
+		// holds a copy of it. Revoke the whole family to lock both parties out.
+		if used, err := h.store.Sessions.FindByToken(ctx, hash); err == nil && used.UsedAt != nil {
+			log.Printf("Refresh token reuse detected for user %s, revoking session family %s", used.UserID.Hex(), used.FamilyID.Hex())
+			if _, err := h.store.Sessions.RevokeFamily(ctx, used.UserID, used.FamilyID); err != nil {
+				log.Printf("Failed to revoke session family %s: %v", used.FamilyID.Hex(), err)
+			}
+		}
+		return apierror.Unauthorized(apierror.CodeInvalidToken, "invalid or expired refresh token")
+	}
+	if err != nil {
+		return apierror.Internal("failed to refresh session").Wrap(err)
+	}
+
+	user, err := h.store.Users.FindByID(ctx, session.UserID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.Unauthorized(apierror.CodeInvalidToken, "invalid or expired refresh token")
+		}
+		return apierror.Internal("failed to find user").Wrap(err)
+	}
+
+	if user.Disabled {
+		return apierror.Forbidden(apierror.CodeAccountDisabled, "account is disabled")
+	}
+
+	tokens, err := h.issueTokens(ctx, c, user, session.FamilyID, session.AuthTime)
+	if err != nil {
+		return apierror.Internal("failed to issue token").Wrap(err)
+	}
+
+	return c.JSON(tokens)
+}
+
+// SessionActive reports whether the login an access token belongs to is
+// still going, for RequireAuth. Logging out, a revoked refresh token family
+// and disabling the account all end it.
+func (h *AuthHandler) SessionActive(ctx context.Context, userID primitive.ObjectID, sessionID string) (bool, error) {
+	familyID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return false, nil
+	}
+
+	active, err := h.store.Sessions.FamilyActive(ctx, userID, familyID, time.Now())
+	if err != nil || !active {
+		return false, err
+	}
+
+	user, err := h.store.Users.FindByID(ctx, userID)
+	if err == repository.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !user.Disabled, nil
+}
+
+// reauthWindow is how long after signing in an account without a password
+// can make the changes that otherwise ask for it
+const reauthWindow = 10 * time.Minute
+
+// confirmIdentity checks that the caller is the account holder before a
+// sensitive change: by the current password, or for accounts that never had
+// one, by having signed in within reauthWindow. Refreshing tokens doesn't
+// count as signing in.
+func confirmIdentity(c *fiber.Ctx, user models.User, password string) error {
+	if user.Password == "" {
+		claims := auth.CurrentClaims(c)
+		if claims == nil || claims.AuthTime == nil || time.Since(claims.AuthTime.Time) > reauthWindow {
+			return apierror.Unauthorized(apierror.CodeReauthRequired, "sign in again to confirm it's you")
+		}
+		return nil
+	}
+
+	if password == "" {
+		return apierror.BadRequest(apierror.CodeMissingField, "password is required")
+	}
+	if !CheckPasswordHash(password, user.Password) {
+		return apierror.Unauthorized(apierror.CodeInvalidCredentials, "password is incorrect")
+	}
+	return nil
+}
+
+// Logout revokes the refresh tokens of the session the access token belongs to
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	claims := auth.CurrentClaims(c)
+	familyID, err := primitive.ObjectIDFromHex(claims.SessionID)
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidToken, "token is not bound to a session")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.store.Sessions.RevokeFamily(ctx, auth.CurrentUserID(c), familyID); err != nil {
+		return apierror.Internal("failed to revoke session").Wrap(err)
+	}
+
+	return c.JSON(fiber.Map{"message": "logged out successfully"})
+}
+
+// LogoutAll revokes the refresh tokens of every session the user has open
+func (h *AuthHandler) LogoutAll(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	revoked, err := h.store.Sessions.RevokeAll(ctx, auth.CurrentUserID(c))
+	if err != nil {
+		return apierror.Internal("failed to revoke sessions").Wrap(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":       "logged out of all sessions",
+		"revoked_count": revoked,
+	})
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+	"github.com/kashyapprajapat/collecthub_api/search"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+
+	// snippetWidth is roughly how much of a field a highlight shows
+	snippetWidth = 160
+)
+
+// Search ranks the authenticated user's documents by how well their text
+// fields match ?q=, most relevant first, with ?page= and ?limit=. Each
+// result carries its score and a highlighted snippet of every field that
+// matched.
+func (r *Resource[T]) Search(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	query := search.Parse(q)
+	if query.Empty() {
+		return apierror.BadRequest(apierror.CodeInvalidParameter, "q must contain a word to search for")
+	}
+
+	page, limit, msg := pageParams(c, defaultSearchPageSize, maxSearchPageSize)
+	if msg != "" {
+		return apierror.BadRequest(apierror.CodeInvalidParameter, msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hits, total, err := r.repo.Search(ctx, auth.CurrentUserID(c), q, page, limit)
+	if err != nil {
+		return apierror.Internal("failed to search " + r.Plural).Wrap(err)
+	}
+
+	results := make([]fiber.Map, len(hits))
+	for i := range hits {
+		results[i] = fiber.Map{
+			"score":      hits[i].Score,
+			"highlights": r.highlights(&hits[i].Doc, query),
+			"item":       hits[i].Doc,
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"results": results,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+	})
+}
+
+// highlights returns the snippets of doc's text fields matching query, by
+// JSON name. The store's matching is more thorough than package search, so
+// a result may have none.
+func (r *Resource[T]) highlights(doc *T, query search.Query) map[string]string {
+	snippets := map[string]string{}
+	for _, field := range repository.TextFields[r.Name] {
+		text, _ := r.field(doc, field.Name).Interface().(string)
+		if snippet := query.Snippet(text, snippetWidth); snippet != "" {
+			snippets[r.names[field.Name]] = snippet
+		}
+	}
+	return snippets
+}
@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+)
+
+const (
+	totpIssuer        = "CollectHub"
+	recoveryCodeCount = 10
+)
+
+// totpClock is the time source for TOTP checks, replaceable in tests
+var totpClock = time.Now
+
+// SetupTwoFactor generates a new TOTP secret for the current user. It only
+// takes effect once a code from it is confirmed through VerifyTwoFactor.
+func (h *AuthHandler) SetupTwoFactor(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := h.store.Users.FindByID(ctx, auth.CurrentUserID(c))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.NotFound("user not found")
+		}
+		return apierror.Internal("failed to fetch user").Wrap(err)
+	}
+
+	if user.TOTPEnabled {
+		return apierror.Conflict(apierror.CodeTwoFactorAlreadyEnabled, "two-factor authentication is already enabled")
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return apierror.Internal("failed to generate secret").Wrap(err)
+	}
+
+	_, err = h.store.Users.Update(ctx, user.ID, map[string]interface{}{"totp_pending_secret": secret})
+	if err != nil {
+		return apierror.Internal("failed to start two-factor setup").Wrap(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// VerifyTwoFactor confirms the pending secret with a code from the
+// authenticator app, enables two-factor and returns one-time recovery codes
+func (h *AuthHandler) VerifyTwoFactor(c *fiber.Ctx) error {
+	var req models.TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+	if req.Code == "" {
+		return apierror.BadRequest(apierror.CodeMissingField, "code is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := h.store.Users.FindByID(ctx, auth.CurrentUserID(c))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.NotFound("user not found")
+		}
+		return apierror.Internal("failed to fetch user").Wrap(err)
+	}
+
+	if user.TOTPEnabled {
+		return apierror.Conflict(apierror.CodeTwoFactorAlreadyEnabled, "two-factor authentication is already enabled")
+	}
+	if user.TOTPPendingSecret == "" {
+		return apierror.BadRequest(apierror.CodeTwoFactorSetupRequired, "start two-factor setup first")
+	}
+
+	step, ok := auth.ValidateTOTP(user.TOTPPendingSecret, req.Code, totpClock())
+	if !ok {
+		return apierror.BadRequest(apierror.CodeInvalidTwoFactorCode, "invalid two-factor code")
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return apierror.Internal("failed to generate recovery codes").Wrap(err)
+	}
+
+	_, err = h.store.Users.Update(ctx, user.ID, map[string]interface{}{
+		"totp_enabled":        true,
+		"totp_secret":         user.TOTPPendingSecret,
+		"totp_last_step":      step,
+		"recovery_codes":      hashes,
+		"totp_pending_secret": nil,
+	})
+	if err != nil {
+		return apierror.Internal("failed to enable two-factor authentication").Wrap(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor off after checking the password and a
+// current code or recovery code
+func (h *AuthHandler) DisableTwoFactor(c *fiber.Ctx) error {
+	var req models.DisableTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+	if req.Code == "" {
+		return apierror.BadRequest(apierror.CodeMissingField, "code is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := h.store.Users.FindByID(ctx, auth.CurrentUserID(c))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.NotFound("user not found")
+		}
+		return apierror.Internal("failed to fetch user").Wrap(err)
+	}
+
+	if !user.TOTPEnabled {
+		return apierror.BadRequest(apierror.CodeTwoFactorNotEnabled, "two-factor authentication is not enabled")
+	}
+	if err := confirmIdentity(c, user, req.Password); err != nil {
+		return err
+	}
+
+	ok, err := h.verifySecondFactor(ctx, user, req.Code, req.Code)
+	if err != nil {
+		return apierror.Internal("failed to verify two-factor code").Wrap(err)
+	}
+	if !ok {
+		return apierror.Unauthorized(apierror.CodeInvalidTwoFactorCode, "invalid two-factor code")
+	}
+
+	_, err = h.store.Users.Update(ctx, user.ID, map[string]interface{}{
+		"totp_enabled":        false,
+		"totp_secret":         nil,
+		"totp_pending_secret": nil,
+		"totp_last_step":      nil,
+		"recovery_codes":      nil,
+	})
+	if err != nil {
+		return apierror.Internal("failed to disable two-factor authentication").Wrap(err)
+	}
+
+	return c.JSON(fiber.Map{"message": "two-factor authentication disabled"})
+}
+
+// LoginTwoFactor completes a login started by LoginUser for accounts with
+// two-factor enabled, using a TOTP code or a recovery code
+func (h *AuthHandler) LoginTwoFactor(c *fiber.Ctx) error {
+	var req models.TwoFactorLoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+	if req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		return apierror.BadRequest(apierror.CodeMissingField, "challenge_token and code or recovery_code are required")
+	}
+
+	userID, err := auth.ParseChallengeToken(req.ChallengeToken)
+	if err != nil {
+		return apierror.Unauthorized(apierror.CodeInvalidToken, "invalid or expired challenge token")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := h.store.Users.FindByID(ctx, userID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.Unauthorized(apierror.CodeInvalidToken, "invalid or expired challenge token")
+		}
+		return apierror.Internal("failed to find user").Wrap(err)
+	}
+
+	if user.Disabled {
+		return apierror.Forbidden(apierror.CodeAccountDisabled, "account is disabled")
+	}
+	if !user.TOTPEnabled {
+		return apierror.Unauthorized(apierror.CodeInvalidToken, "invalid or expired challenge token")
+	}
+
+	// Six digit codes are easy to guess, so they share the login lockout
+	retryAfter, err := h.loginRetryAfter(ctx, emailAttemptKey(user.Email), ipAttemptKey(c.IP()))
+	if err != nil {
+		return apierror.Internal("failed to check login attempts").Wrap(err)
+	}
+	if retryAfter > 0 {
+		h.auditLoginFailure(c, &user.ID, user.Email, "locked_out")
+		c.Set(fiber.HeaderRetryAfter, retryAfterSeconds(retryAfter))
+		return apierror.TooManyRequests("too many failed login attempts, try again later")
+	}
+
+	ok, err := h.verifySecondFactor(ctx, user, req.Code, req.RecoveryCode)
+	if err != nil {
+		return apierror.Internal("failed to verify two-factor code").Wrap(err)
+	}
+	if !ok {
+		h.recordLoginFailures(ctx, c, user.Email)
+		h.auditLoginFailure(c, &user.ID, user.Email, "invalid_second_factor")
+		return apierror.Unauthorized(apierror.CodeInvalidTwoFactorCode, "invalid two-factor code")
+	}
+
+	return h.completeLogin(ctx, c, user)
+}
+
+// verifySecondFactor accepts a TOTP code that hasn't been used before or an
+// unused recovery code, consuming whichever one matched
+func (h *AuthHandler) verifySecondFactor(ctx context.Context, user models.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, totpClock()); ok {
+			// Only move forward in time so a code can't be replayed
+			advanced, err := h.store.Users.AdvanceTOTPStep(ctx, user.ID, step)
+			if err != nil {
+				return false, err
+			}
+			if advanced {
+				return true, nil
+			}
+		}
+	}
+
+	if recoveryCode != "" {
+		hash := auth.HashOpaqueToken(normalizeRecoveryCode(recoveryCode))
+		used, err := h.store.Users.UseRecoveryCode(ctx, user.ID, hash)
+		if err != nil {
+			return false, err
+		}
+		if used {
+			log.Printf("Recovery code used for user %s", user.ID.Hex())
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// newRecoveryCodes returns recovery codes formatted like
+// "ABCDEFGH-IJKLMNOP-QRSTUVWX-YZ234567" and their hashes for storage. Each
+// carries 160 random bits, enough that a fast hash resists offline guessing
+// like it does for other opaque tokens.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 20)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := base32.StdEncoding.EncodeToString(buf)
+		codes = append(codes, raw[:8]+"-"+raw[8:16]+"-"+raw[16:24]+"-"+raw[24:])
+		hashes = append(hashes, auth.HashOpaqueToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,279 @@
+package controllers_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/controllers"
+	"github.com/kashyapprajapat/collecthub_api/models"
+)
+
+// twoFactorUser is an account with a password that has enabled two-factor
+// authentication at the step clock is in
+type twoFactorUser struct {
+	user          models.User
+	token         string
+	secret        string
+	recoveryCodes []string
+}
+
+// stepClock is a TOTP time source that tests move a step at a time
+type stepClock struct {
+	now time.Time
+}
+
+func (c *stepClock) step() int64 {
+	return auth.TOTPStep(c.now)
+}
+
+func (c *stepClock) set(step int64) {
+	// Mid-step, so codes don't depend on rounding at the boundary
+	c.now = time.Unix(step*30+10, 0)
+}
+
+func newStepClock(t *testing.T) *stepClock {
+	c := &stepClock{}
+	c.set(auth.TOTPStep(time.Now()))
+	t.Cleanup(controllers.SetTOTPClock(func() time.Time { return c.now }))
+	return c
+}
+
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+
+	code, err := auth.TOTPCode(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func (s *testServer) addTwoFactorUser(t *testing.T, clock *stepClock) twoFactorUser {
+	t.Helper()
+
+	user, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+	s.setPassword(t, user, testPassword)
+
+	var setup struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+	if status := s.do(t, "POST", "/api/users/me/2fa/setup", token, nil, &setup); status != 200 || setup.Secret == "" {
+		t.Fatalf("setup: status %d, response %+v", status, setup)
+	}
+	if !strings.Contains(setup.OTPAuthURI, "secret="+setup.Secret) {
+		t.Fatalf("otpauth_uri %s doesn't carry the secret", setup.OTPAuthURI)
+	}
+
+	var verified struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	body := models.TwoFactorCodeRequest{Code: totpCode(t, setup.Secret, clock.step())}
+	if status := s.do(t, "POST", "/api/users/me/2fa/verify", token, body, &verified); status != 200 || len(verified.RecoveryCodes) != 10 {
+		t.Fatalf("verify: status %d, response %+v", status, verified)
+	}
+
+	return twoFactorUser{user: user, token: token, secret: setup.Secret, recoveryCodes: verified.RecoveryCodes}
+}
+
+// challenge signs in with the password and returns the challenge token
+func (s *testServer) challenge(t *testing.T, email string) string {
+	t.Helper()
+
+	var resp struct {
+		TwoFactorRequired bool                  `json:"two_factor_required"`
+		ChallengeToken    string                `json:"challenge_token"`
+		User              *models.LoginResponse `json:"user"`
+	}
+	status := s.do(t, "POST", "/api/users/login", "", map[string]string{"email": email, "password": testPassword}, &resp)
+	if status != 200 || !resp.TwoFactorRequired || resp.ChallengeToken == "" || resp.User != nil {
+		t.Fatalf("login: status %d, response %+v, want only a challenge", status, resp)
+	}
+	return resp.ChallengeToken
+}
+
+// secondFactor completes a login with a TOTP code or recovery code
+func (s *testServer) secondFactor(t *testing.T, req models.TwoFactorLoginRequest) (int, string) {
+	t.Helper()
+
+	var resp struct {
+		Code string               `json:"code"`
+		User models.LoginResponse `json:"user"`
+	}
+	status := s.do(t, "POST", "/api/users/login/2fa", "", req, &resp)
+	if status == 200 {
+		if resp.User.Token == "" {
+			t.Fatalf("second factor: no token in %+v", resp)
+		}
+		return status, ""
+	}
+	return status, resp.Code
+}
+
+func TestTwoFactorSetup(t *testing.T) {
+	s := newTestServer(t)
+	clock := newStepClock(t)
+	_, token := s.addUser(t, "Ada", "ada@example.com", models.RoleUser)
+
+	var problem map[string]interface{}
+	body := models.TwoFactorCodeRequest{Code: "123456"}
+	if status := s.do(t, "POST", "/api/users/me/2fa/verify", token, body, &problem); status != 400 || problem["code"] != apierror.CodeTwoFactorSetupRequired {
+		t.Fatalf("verify before setup: status %d, problem %v", status, problem)
+	}
+
+	var setup struct {
+		Secret string `json:"secret"`
+	}
+	s.do(t, "POST", "/api/users/me/2fa/setup", token, nil, &setup)
+
+	// A code from outside the window doesn't confirm the secret
+	problem = nil
+	body.Code = totpCode(t, setup.Secret, clock.step()+2)
+	if status := s.do(t, "POST", "/api/users/me/2fa/verify", token, body, &problem); status != 400 || problem["code"] != apierror.CodeInvalidTwoFactorCode {
+		t.Fatalf("verify with a wrong code: status %d, problem %v", status, problem)
+	}
+
+	body.Code = totpCode(t, setup.Secret, clock.step()-1)
+	if status := s.do(t, "POST", "/api/users/me/2fa/verify", token, body, nil); status != 200 {
+		t.Fatalf("verify: status %d", status)
+	}
+
+	problem = nil
+	if status := s.do(t, "POST", "/api/users/me/2fa/setup", token, nil, &problem); status != 409 || problem["code"] != apierror.CodeTwoFactorAlreadyEnabled {
+		t.Fatalf("setup when enabled: status %d, problem %v", status, problem)
+	}
+}
+
+func TestTwoFactorLoginAcceptsOneStepOfDrift(t *testing.T) {
+	s := newTestServer(t)
+	clock := newStepClock(t)
+	u := s.addTwoFactorUser(t, clock)
+	challenge := s.challenge(t, u.user.Email)
+	start := clock.step()
+
+	for _, tt := range []struct {
+		name       string
+		clock      int64 // Steps after setup
+		code       int64 // Steps after setup the code is for
+		wantStatus int
+	}{
+		{"code used to enable two-factor", 0, 0, 401},
+		{"one step behind", 2, 1, 200},
+		{"replayed", 2, 1, 401},
+		{"one step ahead", 2, 3, 200},
+		{"older than the last code used", 2, 2, 401},
+		{"two steps behind", 10, 8, 401},
+		{"two steps ahead", 10, 12, 401},
+		{"current", 10, 10, 200},
+	} {
+		clock.set(start + tt.clock)
+		status, code := s.secondFactor(t, models.TwoFactorLoginRequest{
+			ChallengeToken: challenge,
+			Code:           totpCode(t, u.secret, start+tt.code),
+		})
+		if status != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.name, status, tt.wantStatus)
+		}
+		if status == 401 && code != apierror.CodeInvalidTwoFactorCode {
+			t.Errorf("%s: code %s, want %s", tt.name, code, apierror.CodeInvalidTwoFactorCode)
+		}
+	}
+
+	user, err := s.store.Users.FindByID(context.Background(), u.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.TOTPLastStep != start+10 {
+		t.Fatalf("totp_last_step = %d, want %d", user.TOTPLastStep, start+10)
+	}
+}
+
+func TestTwoFactorRecoveryCodesAreSingleUse(t *testing.T) {
+	s := newTestServer(t)
+	clock := newStepClock(t)
+	u := s.addTwoFactorUser(t, clock)
+	challenge := s.challenge(t, u.user.Email)
+
+	// Long enough to withstand guessing against a leaked hash
+	for _, code := range u.recoveryCodes {
+		if raw := strings.ReplaceAll(code, "-", ""); len(raw) != 32 {
+			t.Fatalf("recovery code %s has %d characters, want 32", code, len(raw))
+		}
+	}
+
+	// Recovery codes are matched regardless of case and dashes
+	first := strings.ToLower(strings.ReplaceAll(u.recoveryCodes[0], "-", ""))
+	if status, code := s.secondFactor(t, models.TwoFactorLoginRequest{ChallengeToken: challenge, RecoveryCode: first}); status != 200 {
+		t.Fatalf("recovery code: status %d, code %s", status, code)
+	}
+	if status, code := s.secondFactor(t, models.TwoFactorLoginRequest{ChallengeToken: challenge, RecoveryCode: u.recoveryCodes[0]}); status != 401 || code != apierror.CodeInvalidTwoFactorCode {
+		t.Fatalf("reused recovery code: status %d, code %s", status, code)
+	}
+	if status, _ := s.secondFactor(t, models.TwoFactorLoginRequest{ChallengeToken: challenge, RecoveryCode: u.recoveryCodes[1]}); status != 200 {
+		t.Fatalf("second recovery code: status %d", status)
+	}
+
+	user, err := s.store.Users.FindByID(context.Background(), u.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.RecoveryCodes) != 8 {
+		t.Fatalf("%d recovery codes left, want 8", len(user.RecoveryCodes))
+	}
+}
+
+func TestTwoFactorChallengeToken(t *testing.T) {
+	s := newTestServer(t)
+	clock := newStepClock(t)
+	u := s.addTwoFactorUser(t, clock)
+	challenge := s.challenge(t, u.user.Email)
+	code := totpCode(t, u.secret, clock.step()+1)
+
+	// The challenge doesn't authenticate on its own, and an access token
+	// doesn't stand in for it
+	if status := s.do(t, "GET", "/api/users/me", challenge, nil, nil); status != 401 {
+		t.Fatalf("challenge as access token: status %d, want 401", status)
+	}
+	for _, token := range []string{u.token, "not-a-token"} {
+		if status, c := s.secondFactor(t, models.TwoFactorLoginRequest{ChallengeToken: token, Code: code}); status != 401 || c != apierror.CodeInvalidToken {
+			t.Fatalf("challenge %.10s: status %d, code %s", token, status, c)
+		}
+	}
+	if status, c := s.secondFactor(t, models.TwoFactorLoginRequest{ChallengeToken: challenge}); status != 400 || c != apierror.CodeMissingField {
+		t.Fatalf("no code: status %d, code %s", status, c)
+	}
+
+	if status, c := s.secondFactor(t, models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: code}); status != 200 {
+		t.Fatalf("second factor: status %d, code %s", status, c)
+	}
+}
+
+func TestTwoFactorDisable(t *testing.T) {
+	s := newTestServer(t)
+	clock := newStepClock(t)
+	u := s.addTwoFactorUser(t, clock)
+
+	var problem map[string]interface{}
+	body := models.DisableTwoFactorRequest{Password: "wrong", Code: totpCode(t, u.secret, clock.step()+1)}
+	if status := s.do(t, "POST", "/api/users/me/2fa/disable", u.token, body, &problem); status != 401 || problem["code"] != apierror.CodeInvalidCredentials {
+		t.Fatalf("wrong password: status %d, problem %v", status, problem)
+	}
+
+	body.Password = testPassword
+	if status := s.do(t, "POST", "/api/users/me/2fa/disable", u.token, body, nil); status != 200 {
+		t.Fatalf("disable: status %d", status)
+	}
+
+	// Logging in no longer asks for a second factor
+	var login struct {
+		User models.LoginResponse `json:"user"`
+	}
+	status := s.do(t, "POST", "/api/users/login", "", map[string]string{"email": u.user.Email, "password": testPassword}, &login)
+	if status != 200 || login.User.Token == "" {
+		t.Fatalf("login: status %d, response %+v", status, login)
+	}
+}
@@ -2,152 +2,243 @@ package controllers
 
 import (
     "context"
+    "github.com/kashyapprajapat/collecthub_api/apierror"
+    "github.com/kashyapprajapat/collecthub_api/auth"
+    "github.com/kashyapprajapat/collecthub_api/mailer"
     "github.com/kashyapprajapat/collecthub_api/models"
+    "github.com/kashyapprajapat/collecthub_api/repository"
+    "github.com/kashyapprajapat/collecthub_api/sso"
+    "github.com/kashyapprajapat/collecthub_api/validation"
     "log"
     "time"
 
     "github.com/gofiber/fiber/v2"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
-    "go.mongodb.org/mongo-driver/mongo"
-    "golang.org/x/crypto/bcrypt"
 )
 
-var userCollection *mongo.Collection
+// AuthHandler serves signup, login and everything else that proves or
+// changes how a user signs in
+type AuthHandler struct {
+    store    *repository.Store
+    mail     mailer.Mailer
+    provider *sso.Provider // Nil when external sign-in is switched off
+}
 
-func InitUserController(db *mongo.Database) {
-    userCollection = db.Collection("users")
+func NewAuthHandler(store *repository.Store, mail mailer.Mailer, provider *sso.Provider) *AuthHandler {
+    return &AuthHandler{store: store, mail: mail, provider: provider}
 }
 
-// HashPassword hashes the password using bcrypt
+// HashPassword hashes the password with the configured algorithm
 func HashPassword(password string) (string, error) {
-    bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-    return string(bytes), err
+    return auth.HashPassword(password)
 }
 
 // CheckPasswordHash compares password with hash
 func CheckPasswordHash(password, hash string) bool {
-    err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-    return err == nil
+    return auth.VerifyPassword(password, hash)
 }
 
-func CreateUser(c *fiber.Ctx) error {
+func (h *AuthHandler) CreateUser(c *fiber.Ctx) error {
 
     var user models.User
     if err := c.BodyParser(&user); err != nil {
         log.Printf("Body parsing error: %v", err)
-        return c.Status(400).JSON(fiber.Map{"error": "cannot parse JSON"})
+        return apierror.InvalidBody()
     }
 
-    
-    // Validate required fields
-    if user.Name == "" || user.Email == "" || user.Password == "" {
-        return c.Status(400).JSON(fiber.Map{"error": "name, email, and password are required"})
+    // Validate every field at once so the signup form can show all problems
+    errs := validation.Struct(&user)
+    email, err := normalizeEmail(user.Email)
+    if err != nil && user.Email != "" {
+        errs.Add("email", validation.CodeInvalid, "email must be a valid email address")
+    }
+    if user.Password != "" {
+        if err := auth.CheckPasswordPolicy(user.Password); err != nil {
+            errs.Add("password", validation.CodeInvalid, err.Error())
+        }
     }
+    if len(errs) > 0 {
+        return apierror.Validation(errs)
+    }
+    user.Email = email
 
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
+    // New accounts always start unverified, enabled, with the regular user role
+    user.Verified = false
+    user.Role = models.RoleUser
+    user.Disabled = false
 
-    // Check if user with email already exists
-    var existingUser models.User
-    err := userCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&existingUser)
-    if err == nil {
-        return c.Status(409).JSON(fiber.Map{"error": "user with this email already exists"})
-    }
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
 
     // Hash the password
     hashedPassword, err := HashPassword(user.Password)
     if err != nil {
-        return c.Status(500).JSON(fiber.Map{"error": "failed to hash password"})
+        return apierror.Internal("failed to hash password").Wrap(err)
     }
     user.Password = hashedPassword
 
     // Generate new ObjectID for the user
     user.ID = primitive.NewObjectID()
 
-    res, err := userCollection.InsertOne(ctx, user)
-    if err != nil {
-        return c.Status(500).JSON(fiber.Map{"error": "failed to insert user"})
+    // The unique email index rejects duplicates atomically
+    if err := h.store.Users.Insert(ctx, user); err != nil {
+        if err == repository.ErrDuplicate {
+            return apierror.Conflict(apierror.CodeEmailTaken, "user with this email already exists")
+        }
+        return apierror.Internal("failed to insert user").Wrap(err)
+    }
+
+    if err := sendVerificationEmail(ctx, h.store.EmailVerifications, h.mail, user); err != nil {
+        log.Printf("Failed to send verification email: %v", err)
     }
 
     // Return user without password
     response := fiber.Map{
-        "id":      res.InsertedID,
-        "name":    user.Name,
-        "email":   user.Email,
-        "message": "user created successfully",
+        "id":       user.ID,
+        "name":     user.Name,
+        "email":    user.Email,
+        "verified": user.Verified,
+        "message":  "user created successfully, check your inbox to verify your email",
     }
 
     return c.Status(201).JSON(response)
 }
 
-func GetUsers(c *fiber.Ctx) error {
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-    defer cancel()
-
-    cursor, err := userCollection.Find(ctx, bson.M{})
-    if err != nil {
-        return c.Status(500).JSON(fiber.Map{"error": "failed to fetch users"})
-    }
-    defer cursor.Close(ctx)
-    
-    var users []models.User
-    if err = cursor.All(ctx, &users); err != nil {
-        return c.Status(500).JSON(fiber.Map{"error": "failed to decode users"})
-    }
-
-    // Remove passwords from response (extra safety)
-    var safeUsers []fiber.Map
-    for _, user := range users {
-        safeUsers = append(safeUsers, fiber.Map{
-            "id":    user.ID,
-            "name":  user.Name,
-            "email": user.Email,
-        })
-    }
-
-    return c.JSON(safeUsers)
-}
-
-func LoginUser(c *fiber.Ctx) error {
+func (h *AuthHandler) LoginUser(c *fiber.Ctx) error {
     var loginReq models.LoginRequest
     if err := c.BodyParser(&loginReq); err != nil {
-        return c.Status(400).JSON(fiber.Map{"error": "cannot parse JSON"})
+        return apierror.InvalidBody()
     }
 
     // Validate required fields
     if loginReq.Email == "" || loginReq.Password == "" {
-        return c.Status(400).JSON(fiber.Map{"error": "email and password are required"})
+        return apierror.BadRequest(apierror.CodeMissingField, "email and password are required")
     }
 
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
 
+    // Refuse locked out emails and IPs before spending any time on bcrypt
+    retryAfter, err := h.loginRetryAfter(ctx, emailAttemptKey(loginReq.Email), ipAttemptKey(c.IP()))
+    if err != nil {
+        return apierror.Internal("failed to check login attempts").Wrap(err)
+    }
+    if retryAfter > 0 {
+        h.auditLoginFailure(c, nil, loginReq.Email, "locked_out")
+        c.Set(fiber.HeaderRetryAfter, retryAfterSeconds(retryAfter))
+        return apierror.TooManyRequests("too many failed login attempts, try again later")
+    }
+
     // Find user by email
-    var user models.User
-    err := userCollection.FindOne(ctx, bson.M{"email": loginReq.Email}).Decode(&user)
+    user, err := h.store.Users.FindByEmail(ctx, loginReq.Email)
     if err != nil {
-        if err == mongo.ErrNoDocuments {
-            return c.Status(401).JSON(fiber.Map{"error": "invalid email or password"})
+        if err == repository.ErrNotFound {
+            h.recordLoginFailures(ctx, c, loginReq.Email)
+            h.auditLoginFailure(c, nil, loginReq.Email, "unknown_email")
+            return apierror.Unauthorized(apierror.CodeInvalidCredentials, "invalid email or password")
         }
-        return c.Status(500).JSON(fiber.Map{"error": "failed to find user"})
+        return apierror.Internal("failed to find user").Wrap(err)
     }
 
     // Check password
     if !CheckPasswordHash(loginReq.Password, user.Password) {
-        return c.Status(401).JSON(fiber.Map{"error": "invalid email or password"})
+        h.recordLoginFailures(ctx, c, loginReq.Email)
+        h.auditLoginFailure(c, &user.ID, user.Email, "invalid_password")
+        return apierror.Unauthorized(apierror.CodeInvalidCredentials, "invalid email or password")
     }
 
+    // The plaintext password is only available now, so this is when hashes
+    // made with an old algorithm or old parameters get upgraded
+    if auth.PasswordNeedsRehash(user.Password) {
+        h.rehashPassword(ctx, user, loginReq.Password)
+    }
+
+    return h.beginLogin(ctx, c, user)
+}
+
+// rehashPassword stores a fresh hash of a just verified password. It only
+// replaces the old hash so a concurrent password change always wins.
+func (h *AuthHandler) rehashPassword(ctx context.Context, user models.User, password string) {
+    hashedPassword, err := HashPassword(password)
+    if err != nil {
+        log.Printf("Password rehash error for user %s: %v", user.ID.Hex(), err)
+        return
+    }
+    err = h.store.Users.ReplacePassword(ctx, user.ID, user.Password, hashedPassword)
+    if err != nil && err != repository.ErrNotFound {
+        log.Printf("Failed to store upgraded password hash for user %s: %v", user.ID.Hex(), err)
+    }
+}
+
+// beginLogin continues a login once the user has proven who they are, with a
+// password or an external identity provider
+func (h *AuthHandler) beginLogin(ctx context.Context, c *fiber.Ctx, user models.User) error {
+    if user.Disabled {
+        h.auditLoginFailure(c, &user.ID, user.Email, "account_disabled")
+        return apierror.Forbidden(apierror.CodeAccountDisabled, "account is disabled")
+    }
+
+    // With two-factor enabled the first factor alone only earns a challenge
+    // token, exchanged for real tokens at /users/login/2fa
+    if user.TOTPEnabled {
+        challenge, expiresAt, err := auth.IssueChallengeToken(user.ID)
+        if err != nil {
+            return apierror.Internal("failed to issue token").Wrap(err)
+        }
+        return c.JSON(fiber.Map{
+            "message":              "two-factor authentication required",
+            "two_factor_required":  true,
+            "challenge_token":      challenge,
+            "challenge_expires_at": expiresAt,
+        })
+    }
+
+    return h.completeLogin(ctx, c, user)
+}
+
+// completeLogin starts a new session for a fully authenticated user
+func (h *AuthHandler) completeLogin(ctx context.Context, c *fiber.Ctx, user models.User) error {
+    h.clearLoginFailures(ctx, user.Email)
+
+    // Every login starts a new session family for refresh token rotation
+    tokens, err := h.issueTokens(ctx, c, user, primitive.NewObjectID(), time.Now())
+    if err != nil {
+        return apierror.Internal("failed to issue token").Wrap(err)
+    }
+
+    recordAuditTo(c, h.store.Audit, models.AuditEvent{
+        Action:  models.AuditLoginSucceeded,
+        ActorID: &user.ID,
+        UserID:  &user.ID,
+        Details: bson.M{"two_factor": user.TOTPEnabled},
+    })
+
     // Login successful - return user data without password
     response := models.LoginResponse{
-        ID:    user.ID,
-        Name:  user.Name,
-        Email: user.Email,
-        // Token: "your-jwt-token-here", // Add JWT token if needed
+        ID:               user.ID,
+        Name:             user.Name,
+        Email:            user.Email,
+        Verified:         user.Verified,
+        Role:             user.EffectiveRole(),
+        Token:            tokens.Token,
+        ExpiresAt:        tokens.ExpiresAt,
+        RefreshToken:     tokens.RefreshToken,
+        RefreshExpiresAt: tokens.RefreshExpiresAt,
     }
 
     return c.JSON(fiber.Map{
         "message": "login successful",
         "user":    response,
     })
-}
\ No newline at end of file
+}
+
+// auditLoginFailure records a failed login. userID is nil when the email
+// doesn't belong to an account.
+func (h *AuthHandler) auditLoginFailure(c *fiber.Ctx, userID *primitive.ObjectID, email, reason string) {
+    recordAuditTo(c, h.store.Audit, models.AuditEvent{
+        Action:  models.AuditLoginFailed,
+        UserID:  userID,
+        Details: bson.M{"email": email, "reason": reason},
+    })
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+	"github.com/kashyapprajapat/collecthub_api/mailer"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// sendVerificationEmail replaces any pending verification for the user and
+// mails a fresh link for their current address
+func sendVerificationEmail(ctx context.Context, verifications repository.EmailVerificationRepository, mail mailer.Mailer, user models.User) error {
+	if _, err := verifications.DeleteByUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	verification := models.EmailVerification{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(emailVerificationTTL),
+	}
+	if err := verifications.Insert(ctx, verification); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", appBaseURL(), token)
+	return mail.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your CollectHub email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s",
+			user.Name, emailVerificationTTL, link,
+		),
+	})
+}
+
+// VerifyEmail marks the account as verified using the token from the email
+func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req models.VerifyEmailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierror.InvalidBody()
+	}
+	if req.Token == "" {
+		return apierror.BadRequest(apierror.CodeMissingField, "token is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	verification, err := h.store.EmailVerifications.Consume(ctx, auth.HashOpaqueToken(req.Token), time.Now())
+	if err == repository.ErrNotFound {
+		return apierror.BadRequest(apierror.CodeInvalidToken, "invalid or expired verification token")
+	}
+	if err != nil {
+		return apierror.Internal("failed to verify email").Wrap(err)
+	}
+
+	// The link only verifies the address it was sent to
+	if err := h.store.Users.MarkVerified(ctx, verification.UserID, verification.Email); err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.BadRequest(apierror.CodeInvalidToken, "invalid or expired verification token")
+		}
+		return apierror.Internal("failed to verify email").Wrap(err)
+	}
+
+	return c.JSON(fiber.Map{"message": "email verified successfully"})
+}
+
+// ResendVerificationEmail mails a new verification link to the current user
+func (h *AuthHandler) ResendVerificationEmail(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.store.Users.FindByID(ctx, auth.CurrentUserID(c))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return apierror.NotFound("user not found")
+		}
+		return apierror.Internal("failed to find user").Wrap(err)
+	}
+
+	if user.Verified {
+		return apierror.Conflict(apierror.CodeEmailAlreadyVerified, "email is already verified")
+	}
+
+	if err := sendVerificationEmail(ctx, h.store.EmailVerifications, h.mail, user); err != nil {
+		return apierror.Internal("failed to send verification email").Wrap(err)
+	}
+
+	return c.Status(202).JSON(fiber.Map{"message": "verification email sent"})
+}
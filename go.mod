@@ -8,6 +8,14 @@ require (
 	go.mongodb.org/mongo-driver v1.17.4
 )
 
+require (
+	github.com/coreos/go-oidc/v3 v3.15.0
+	github.com/golang-jwt/jwt/v5 v5.2.2
+	golang.org/x/oauth2 v0.30.0
+)
+
+require github.com/go-jose/go-jose/v4 v4.0.5 // indirect
+
 require (
 	github.com/andybalholm/brotli v1.1.0 // indirect
 	github.com/golang/snappy v0.0.4 // indirect
@@ -5,11 +5,17 @@ import (
     "fmt"
     "log"
     "os"
+    "strings"
     "time"
 
     "github.com/gofiber/fiber/v2"
     "github.com/joho/godotenv"
+    "github.com/kashyapprajapat/collecthub_api/apierror"
+    "github.com/kashyapprajapat/collecthub_api/auth"
+    "github.com/kashyapprajapat/collecthub_api/mailer"
+    "github.com/kashyapprajapat/collecthub_api/middleware"
     "github.com/kashyapprajapat/collecthub_api/routes"
+    "github.com/kashyapprajapat/collecthub_api/sso"
     "github.com/gofiber/fiber/v2/middleware/cors" 
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
@@ -26,6 +32,31 @@ func main() {
     dbName := os.Getenv("MONGO_DB")
     port := os.Getenv("PORT")
 
+    // 🔐 Load JWT signing configuration before accepting requests
+    if err := auth.Init(); err != nil {
+        log.Fatalf("Auth configuration error: %v", err)
+    }
+
+    // 🔒 Password hashing algorithm and strength policy
+    if err := auth.InitPasswords(); err != nil {
+        log.Fatalf("Password configuration error: %v", err)
+    }
+
+    // 📧 Mail delivery for password reset links
+    mail, err := mailer.FromEnv()
+    if err != nil {
+        log.Fatalf("Mailer configuration error: %v", err)
+    }
+
+    // 🔑 Optional sign-in with an external OpenID Connect provider. A provider
+    // that can't be reached only switches that sign-in method off.
+    discoveryCtx, cancelDiscovery := context.WithTimeout(context.Background(), 10*time.Second)
+    provider, err := sso.FromEnv(discoveryCtx)
+    cancelDiscovery()
+    if err != nil {
+        log.Printf("OIDC sign-in disabled: %v", err)
+    }
+
     client, err := mongo.NewClient(options.Client().ApplyURI(mongoURI))
     if err != nil {
         log.Fatal(err)
@@ -44,12 +75,43 @@ func main() {
 
     db := client.Database(dbName)
 
-    app := fiber.New()
+    // Behind a load balancer set PROXY_HEADER (e.g. X-Forwarded-For) so
+    // per-IP login throttling and the audit trail see the real client
+    // address. The header is only read from the addresses or CIDR ranges in
+    // TRUSTED_PROXIES, since any client can send it.
+    proxyHeader := os.Getenv("PROXY_HEADER")
+    var trustedProxies []string
+    for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+        if proxy = strings.TrimSpace(proxy); proxy != "" {
+            trustedProxies = append(trustedProxies, proxy)
+        }
+    }
+    if proxyHeader != "" && len(trustedProxies) == 0 {
+        log.Printf("⚠️ Ignoring PROXY_HEADER=%s because TRUSTED_PROXIES is empty", proxyHeader)
+        proxyHeader = ""
+    }
+
+    // Every error is answered as an application/problem+json document
+    app := fiber.New(fiber.Config{
+        ProxyHeader:             proxyHeader,
+        EnableTrustedProxyCheck: true,
+        TrustedProxies:          trustedProxies,
+        EnableIPValidation:      true,
+        ErrorHandler:            apierror.Handler,
+    })
    
-    // 🔓 Enable CORS for all origins
-    app.Use(cors.New())
+    // 🔓 Enable CORS for all origins, letting browsers read the ETag for If-Match
+    app.Use(cors.New(cors.Config{
+        ExposeHeaders: "ETag, Location, X-Request-Id",
+    }))
+
+    // 🏷️ Tag every request with a server-generated X-Request-ID for logs and
+    // the audit trail
+    app.Use(middleware.RequestID())
     
-    routes.SetupRoutes(app, db)
+    if err := routes.SetupRoutes(app, db, mail, provider); err != nil {
+        log.Fatal(err)
+    }
 
     // ✅ Log server startup info
     fmt.Printf("🚀 CollectHub API running on port: %s\n", port)
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+)
+
+// APIKeyPrincipal is the account an API key acts for
+type APIKeyPrincipal struct {
+	UserID        primitive.ObjectID
+	Email         string
+	EmailVerified bool
+	Scopes        []string
+}
+
+// APIKeyResolver looks up an API key, returning nil for unknown, expired or
+// revoked keys
+type APIKeyResolver func(ctx context.Context, key string) (*APIKeyPrincipal, error)
+
+// SessionChecker reports whether the login an access token was issued for,
+// its sid claim, is still active and its account still enabled
+type SessionChecker func(ctx context.Context, userID primitive.ObjectID, sessionID string) (bool, error)
+
+// RequireAuth rejects requests without valid credentials and stores the
+// caller's identity for the handlers that follow. Accepted headers are
+// "Authorization: Bearer <access token>" and "Authorization: ApiKey <key>".
+// Access tokens stop working as soon as their session is revoked, rather
+// than when they expire.
+func RequireAuth(checkSession SessionChecker, resolveAPIKey APIKeyResolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := c.Get(fiber.HeaderAuthorization)
+		scheme, credential, found := strings.Cut(header, " ")
+		credential = strings.TrimSpace(credential)
+		if !found || credential == "" {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="collecthub"`)
+			return apierror.Unauthorized(apierror.CodeUnauthenticated, "missing or malformed authorization header")
+		}
+
+		switch {
+		case strings.EqualFold(scheme, "Bearer"):
+			claims, err := auth.ParseAccessToken(credential)
+			if err != nil {
+				c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="collecthub", error="invalid_token"`)
+				return apierror.Unauthorized(apierror.CodeInvalidToken, "invalid or expired token")
+			}
+
+			userID, _ := primitive.ObjectIDFromHex(claims.Subject)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			active, err := checkSession(ctx, userID, claims.SessionID)
+			if err != nil {
+				return apierror.Internal("failed to check session").Wrap(err)
+			}
+			if !active {
+				c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="collecthub", error="invalid_token"`)
+				return apierror.Unauthorized(apierror.CodeInvalidToken, "session has ended, sign in again")
+			}
+
+			auth.SetIdentity(c, userID, claims)
+
+		case strings.EqualFold(scheme, "ApiKey"):
+			if !auth.LooksLikeAPIKey(credential) {
+				return apierror.Unauthorized(apierror.CodeInvalidAPIKey, "invalid or expired API key")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			principal, err := resolveAPIKey(ctx, credential)
+			if err != nil {
+				return apierror.Internal("failed to check API key").Wrap(err)
+			}
+			if principal == nil {
+				return apierror.Unauthorized(apierror.CodeInvalidAPIKey, "invalid or expired API key")
+			}
+
+			// API keys never carry a role, so they can't reach admin routes
+			auth.SetIdentity(c, principal.UserID, &auth.Claims{
+				Email:         principal.Email,
+				EmailVerified: principal.EmailVerified,
+			})
+			auth.SetAPIKeyScopes(c, principal.Scopes)
+
+		default:
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="collecthub"`)
+			return apierror.Unauthorized(apierror.CodeUnauthenticated, "unsupported authorization scheme")
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+)
+
+// RequestID tags every request with a new X-Request-ID for logs, error
+// responses and the audit trail. An ID sent by the client is replaced, so
+// callers can't write their own values into the append-only audit log.
+func RequestID() fiber.Handler {
+	tag := requestid.New()
+
+	return func(c *fiber.Ctx) error {
+		c.Request().Header.Del(fiber.HeaderXRequestID)
+		return tag(c)
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+)
+
+// RoleLookup returns the current role of an account, or "" when the account
+// no longer exists or is disabled
+type RoleLookup func(ctx context.Context, userID primitive.ObjectID) (string, error)
+
+// RequireRole only lets through callers whose access token carries one of
+// the given roles and whose account still has it, so a demoted or disabled
+// admin loses access at once rather than when the token expires. Must run
+// after RequireAuth.
+func RequireRole(currentRole RoleLookup, roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := auth.CurrentClaims(c)
+		if claims == nil || !slices.Contains(roles, claims.Role) {
+			return forbidden()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		role, err := currentRole(ctx, auth.CurrentUserID(c))
+		if err != nil {
+			return apierror.Internal("failed to check role").Wrap(err)
+		}
+		if !slices.Contains(roles, role) {
+			return forbidden()
+		}
+		return c.Next()
+	}
+}
+
+func forbidden() error {
+	return apierror.Forbidden(apierror.CodeForbidden, "you do not have permission to access this resource")
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+)
+
+// RequireScope rejects API keys that weren't granted scope. Access tokens
+// always pass. Must run after RequireAuth.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !auth.HasScope(c, scope) {
+			return apierror.Forbidden(apierror.CodeInsufficientScope, "API key is missing the "+scope+" scope")
+		}
+		return c.Next()
+	}
+}
+
+// RejectAPIKeys keeps API keys away from account management routes, which
+// need a real signed-in session
+func RejectAPIKeys() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if auth.IsAPIKey(c) {
+			return apierror.Forbidden(apierror.CodeAPIKeyNotAllowed, "this endpoint can't be used with an API key")
+		}
+		return c.Next()
+	}
+}
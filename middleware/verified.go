@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kashyapprajapat/collecthub_api/apierror"
+	"github.com/kashyapprajapat/collecthub_api/auth"
+)
+
+// Features that can be restricted to users with a verified email address.
+// A feature belongs here once a route is guarded by it.
+const (
+	FeatureAI = "ai"
+)
+
+// defaultUnverifiedBlocked is used when UNVERIFIED_BLOCKED_FEATURES is unset
+const defaultUnverifiedBlocked = FeatureAI
+
+// RequireVerifiedEmail rejects users who haven't confirmed their email
+// address when the feature is listed in UNVERIFIED_BLOCKED_FEATURES, a comma
+// separated list such as "ai" ("none" blocks nothing). Must run after
+// RequireAuth.
+func RequireVerifiedEmail(feature string) fiber.Handler {
+	if !unverifiedBlocked(feature) {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		claims := auth.CurrentClaims(c)
+		if claims == nil || !claims.EmailVerified {
+			return apierror.Forbidden(apierror.CodeEmailNotVerified, "verify your email address to use this feature")
+		}
+		return c.Next()
+	}
+}
+
+func unverifiedBlocked(feature string) bool {
+	policy, set := os.LookupEnv("UNVERIFIED_BLOCKED_FEATURES")
+	if !set {
+		policy = defaultUnverifiedBlocked
+	}
+
+	for _, blocked := range strings.Split(policy, ",") {
+		if strings.EqualFold(strings.TrimSpace(blocked), feature) {
+			return true
+		}
+	}
+	return false
+}
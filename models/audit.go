@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit event actions
+const (
+	AuditLoginSucceeded      = "login.succeeded"
+	AuditLoginFailed         = "login.failed"
+	AuditPasswordChanged     = "password.changed"
+	AuditPasswordReset       = "password.reset"
+	AuditUserRoleChanged     = "user.role_changed"
+	AuditUserStatusChanged   = "user.status_changed"
+	AuditAccountDeleted      = "account.deleted"
+	AuditItemDeleted         = "item.deleted"
+	AuditAIAnalysisRequested = "ai.analysis_requested"
+)
+
+// AuditEvent is an append-only record of a security relevant action.
+// ActorID is who performed it, nil when they weren't signed in, and UserID
+// is the account the event concerns.
+type AuditEvent struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Action     string              `bson:"action" json:"action"`
+	ActorID    *primitive.ObjectID `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	UserID     *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	TargetType string              `bson:"target_type,omitempty" json:"target_type,omitempty"` // e.g. "user", "books"
+	TargetID   *primitive.ObjectID `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	IP         string              `bson:"ip" json:"ip"`
+	UserAgent  string              `bson:"user_agent" json:"user_agent"`
+	RequestID  string              `bson:"request_id" json:"request_id"`
+	Before     bson.M              `bson:"before,omitempty" json:"before,omitempty"`
+	After      bson.M              `bson:"after,omitempty" json:"after,omitempty"`
+	Details    bson.M              `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt  time.Time           `bson:"created_at" json:"created_at"`
+}
@@ -1,11 +1,17 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "time"
+)
 
 type Book struct {
-    ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-    BookName    string             `bson:"book_name" json:"book_name"`
-    Author      string             `bson:"author" json:"author"`
-    Reason      string             `bson:"reason" json:"reason"`
-    UserID      primitive.ObjectID `bson:"user_id" json:"user_id"` // Reference to User
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+    BookName  string             `bson:"book_name" json:"book_name" validate:"required,max=200"`
+    Author    string             `bson:"author" json:"author" validate:"max=200"`
+    Reason    string             `bson:"reason" json:"reason" validate:"max=1000"`
+    UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`       // Reference to User
+    CreatedAt time.Time          `bson:"created_at" json:"created_at"` // Set by the server, like the two below
+    UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+    Version   int64              `bson:"version" json:"version"`       // Starts at 1 and goes up with every update
 }
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginAttempt tracks recent failed logins for one email address or one
+// client IP, keyed like "email:a@example.com" or "ip:203.0.113.7"
+type LoginAttempt struct {
+	Key           string    `bson:"_id" json:"key"`
+	Failures      int       `bson:"failures" json:"failures"`
+	LastFailureAt time.Time `bson:"last_failure_at" json:"last_failure_at"`
+	LockedUntil   time.Time `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	ExpiresAt     time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// LoginLockout is the audit record written whenever a key gets locked
+type LoginLockout struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Key         string             `bson:"key" json:"key"`
+	Failures    int                `bson:"failures" json:"failures"`
+	LockedUntil time.Time          `bson:"locked_until" json:"locked_until"`
+	IP          string             `bson:"ip" json:"ip"`
+	UserAgent   string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -1,10 +1,16 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "time"
+)
 
 type Pet struct {
-    ID     primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-    Name   string             `json:"name" bson:"name"`
-    Reason string             `json:"reason" bson:"reason"`
-    UserID primitive.ObjectID `json:"user_id" bson:"user_id"`
+    ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+    Name      string             `json:"name" bson:"name" validate:"required,max=200"`
+    Reason    string             `json:"reason" bson:"reason" validate:"max=1000"`
+    UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+    CreatedAt time.Time          `json:"created_at" bson:"created_at"` // Set by the server, like the two below
+    UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+    Version   int64              `json:"version" bson:"version"`       // Starts at 1 and goes up with every update
 }
@@ -1,10 +1,16 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "time"
+)
 
 type Quote struct {
-    ID     primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-    Quote  string             `json:"quote" bson:"quote"`
-    Author string             `json:"author" bson:"author"`
-    UserID primitive.ObjectID `json:"user_id" bson:"user_id"`
+    ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+    Quote     string             `json:"quote" bson:"quote" validate:"required,max=1000"`
+    Author    string             `json:"author" bson:"author" validate:"max=200"`
+    UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+    CreatedAt time.Time          `json:"created_at" bson:"created_at"` // Set by the server, like the two below
+    UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+    Version   int64              `json:"version" bson:"version"`       // Starts at 1 and goes up with every update
 }
@@ -1,11 +1,17 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "time"
+)
 
 type Recipe struct {
     ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-    Name        string             `json:"name" bson:"name"`
-    Ingredients string             `json:"ingredients" bson:"ingredients"`
-    Reason      string             `json:"reason" bson:"reason"`
+    Name        string             `json:"name" bson:"name" validate:"required,max=200"`
+    Ingredients string             `json:"ingredients" bson:"ingredients" validate:"max=5000"`
+    Reason      string             `json:"reason" bson:"reason" validate:"max=1000"`
     UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+    CreatedAt   time.Time          `json:"created_at" bson:"created_at"` // Set by the server, like the two below
+    UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+    Version     int64              `json:"version" bson:"version"`       // Starts at 1 and goes up with every update
 }
@@ -6,9 +6,12 @@ import (
 )
 
 type TravelBuddy struct {
-    ID           primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-    PlaceName    string             `json:"place_name" bson:"place_name"`
-    DateVisited  time.Time          `json:"date_visited" bson:"date_visited"`
-    Reason       string             `json:"reason" bson:"reason"`
-    UserID       primitive.ObjectID `json:"user_id" bson:"user_id"`
+    ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+    PlaceName   string             `json:"place_name" bson:"place_name" validate:"required,max=200"`
+    DateVisited time.Time          `json:"date_visited" bson:"date_visited" validate:"notfuture"`
+    Reason      string             `json:"reason" bson:"reason" validate:"required,max=1000"`
+    UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+    CreatedAt   time.Time          `json:"created_at" bson:"created_at"` // Set by the server, like the two below
+    UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+    Version     int64              `json:"version" bson:"version"`       // Starts at 1 and goes up with every update
 }
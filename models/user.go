@@ -1,12 +1,41 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "time"
+)
 
 type User struct {
     ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-    Name     string             `bson:"name" json:"name"`
-    Email    string             `bson:"email" json:"email"`
-    Password string             `bson:"password" json:"password,omitempty"` // Allow parsing but can be omitted in responses
+    Name     string             `bson:"name" json:"name" validate:"required,max=100"`
+    Email    string             `bson:"email" json:"email" validate:"required"`
+    Password string             `bson:"password" json:"password,omitempty" validate:"required"` // Allow parsing but can be omitted in responses
+    Verified bool               `bson:"verified" json:"verified"`           // Email address confirmed through the verification link
+    Role     string             `bson:"role,omitempty" json:"role"`         // RoleUser or RoleAdmin
+    Disabled bool               `bson:"disabled" json:"disabled"`           // Disabled accounts can't log in
+
+    // TOTP two-factor authentication, never exposed through the API
+    TOTPEnabled       bool     `bson:"totp_enabled" json:"-"`
+    TOTPSecret        string   `bson:"totp_secret,omitempty" json:"-"`
+    TOTPPendingSecret string   `bson:"totp_pending_secret,omitempty" json:"-"` // Awaiting confirmation during setup
+    TOTPLastStep      int64    `bson:"totp_last_step,omitempty" json:"-"`      // Last accepted time step, blocks code replay
+    RecoveryCodes     []string `bson:"recovery_codes,omitempty" json:"-"`      // Hashed single-use recovery codes
+
+    // Accounts at external identity providers that can sign in as this user
+    ExternalIdentities []ExternalIdentity `bson:"external_identities,omitempty" json:"-"`
+}
+
+const (
+    RoleUser  = "user"
+    RoleAdmin = "admin"
+)
+
+// EffectiveRole treats accounts created before roles existed as regular users
+func (u User) EffectiveRole() string {
+    if u.Role == "" {
+        return RoleUser
+    }
+    return u.Role
 }
 
 type LoginRequest struct {
@@ -15,8 +44,50 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-    ID    primitive.ObjectID `json:"id"`
-    Name  string             `json:"name"`
-    Email string             `json:"email"`
-    Token string             `json:"token,omitempty"` // Optional: for JWT token
-}
\ No newline at end of file
+    ID               primitive.ObjectID `json:"id"`
+    Name             string             `json:"name"`
+    Email            string             `json:"email"`
+    Verified         bool               `json:"verified"`
+    Role             string             `json:"role"`
+    Token            string             `json:"token"`              // Signed JWT access token
+    ExpiresAt        time.Time          `json:"expires_at"`         // Access token expiry
+    RefreshToken     string             `json:"refresh_token"`      // Opaque, single-use refresh token
+    RefreshExpiresAt time.Time          `json:"refresh_expires_at"` // Refresh token expiry
+}
+
+type UpdateProfileRequest struct {
+    Name  *string `json:"name" validate:"required,max=100"` // Rules only apply to fields that are sent
+    Email *string `json:"email" validate:"required"`
+}
+
+type ChangePasswordRequest struct {
+    CurrentPassword string `json:"current_password"`
+    NewPassword     string `json:"new_password"`
+}
+
+type DeleteAccountRequest struct {
+    Password string `json:"password"`
+}
+
+type UpdateUserStatusRequest struct {
+    Disabled *bool `json:"disabled"`
+}
+
+type UpdateUserRoleRequest struct {
+    Role string `json:"role"`
+}
+
+type TwoFactorCodeRequest struct {
+    Code string `json:"code"`
+}
+
+type DisableTwoFactorRequest struct {
+    Password string `json:"password"`
+    Code     string `json:"code"`
+}
+
+type TwoFactorLoginRequest struct {
+    ChallengeToken string `json:"challenge_token"`
+    Code           string `json:"code"`
+    RecoveryCode   string `json:"recovery_code"`
+}
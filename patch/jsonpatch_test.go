@@ -0,0 +1,296 @@
+package patch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kashyapprajapat/collecthub_api/patch"
+)
+
+// jsonEqual compares two JSON documents regardless of member order
+func jsonEqual(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("result %s is not JSON: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("expected %s is not JSON: %v", want, err)
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+func TestApply(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		doc, patch  string
+		want        string // Empty when the patch must fail
+		testFailure bool
+	}{
+		// RFC 6902 Appendix A
+		{
+			name:  "A.1 adding an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "A.2 adding an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:  "A.6 moving a value",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:  "A.7 moving an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name: "A.8 testing a value: success",
+			doc:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[
+				{"op": "test", "path": "/baz", "value": "qux"},
+				{"op": "test", "path": "/foo/1", "value": 2}
+			]`,
+			want: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:        "A.9 testing a value: error",
+			doc:         `{"baz": "qux"}`,
+			patch:       `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			testFailure: true,
+		},
+		{
+			name:  "A.10 adding a nested member object",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:  "A.11 ignoring unrecognized elements",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			want:  `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name:  "A.12 adding to a nonexistent target",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+		},
+		{
+			name: "A.14 ~ escape ordering",
+			doc:  `{"/": 9, "~1": 10}`,
+			patch: `[
+				{"op": "test", "path": "/~01", "value": 10},
+				{"op": "add", "path": "/a~1b", "value": 11}
+			]`,
+			want: `{"/": 9, "~1": 10, "a/b": 11}`,
+		},
+		{
+			name:        "A.15 comparing strings and numbers",
+			doc:         `{"/": 9, "~1": 10}`,
+			patch:       `[{"op": "test", "path": "/~01", "value": "10"}]`,
+			testFailure: true,
+		},
+		{
+			name:  "A.16 adding an array value",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+
+		// Arrays
+		{
+			name:  "add at the end of an array by index",
+			doc:   `{"foo": ["a"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "b"}]`,
+			want:  `{"foo": ["a", "b"]}`,
+		},
+		{
+			name:  "add at the start of an array",
+			doc:   `{"foo": ["a"]}`,
+			patch: `[{"op": "add", "path": "/foo/0", "value": "b"}]`,
+			want:  `{"foo": ["b", "a"]}`,
+		},
+		{
+			name:  "add past the end of an array",
+			doc:   `{"foo": ["a"]}`,
+			patch: `[{"op": "add", "path": "/foo/2", "value": "b"}]`,
+		},
+		{
+			name:  "add into a nested array",
+			doc:   `{"foo": [{"tags": []}]}`,
+			patch: `[{"op": "add", "path": "/foo/0/tags/-", "value": "x"}]`,
+			want:  `{"foo": [{"tags": ["x"]}]}`,
+		},
+		{
+			name:  "copy into an array",
+			doc:   `{"foo": ["a", "b"], "bar": "c"}`,
+			patch: `[{"op": "copy", "from": "/bar", "path": "/foo/1"}]`,
+			want:  `{"foo": ["a", "c", "b"], "bar": "c"}`,
+		},
+		{
+			name: "copies are independent",
+			doc:  `{"foo": {"a": 1}}`,
+			patch: `[
+				{"op": "copy", "from": "/foo", "path": "/bar"},
+				{"op": "replace", "path": "/bar/a", "value": 2}
+			]`,
+			want: `{"foo": {"a": 1}, "bar": {"a": 2}}`,
+		},
+		{
+			name:  "move an object member into an array",
+			doc:   `{"foo": ["a"], "bar": "b"}`,
+			patch: `[{"op": "move", "from": "/bar", "path": "/foo/-"}]`,
+			want:  `{"foo": ["a", "b"]}`,
+		},
+		{
+			name:  "move an array element to the front",
+			doc:   `{"foo": ["a", "b", "c"]}`,
+			patch: `[{"op": "move", "from": "/foo/2", "path": "/foo/0"}]`,
+			want:  `{"foo": ["c", "a", "b"]}`,
+		},
+		{
+			name:  "move to the same place",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo"}]`,
+			want:  `{"foo": {"bar": 1}}`,
+		},
+		{
+			name:  "move a value into itself",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo/bar/baz"}]`,
+		},
+		{
+			name:  "remove the end of an array with -",
+			doc:   `{"foo": ["a"]}`,
+			patch: `[{"op": "remove", "path": "/foo/-"}]`,
+		},
+		{
+			name:  "leading zero index",
+			doc:   `{"foo": ["a", "b"]}`,
+			patch: `[{"op": "replace", "path": "/foo/01", "value": "c"}]`,
+		},
+		{
+			name:  "signed index",
+			doc:   `{"foo": ["a", "b"]}`,
+			patch: `[{"op": "replace", "path": "/foo/+1", "value": "c"}]`,
+		},
+		{
+			name:  "negative zero index",
+			doc:   `{"foo": ["a", "b"]}`,
+			patch: `[{"op": "remove", "path": "/foo/-0"}]`,
+		},
+
+		// Pointers and values
+		{
+			name:  "~0 and ~1 in member names",
+			doc:   `{"a/b": {"c~d": 1}}`,
+			patch: `[{"op": "replace", "path": "/a~1b/c~0d", "value": 2}]`,
+			want:  `{"a/b": {"c~d": 2}}`,
+		},
+		{
+			name:  "empty member name",
+			doc:   `{"": 1}`,
+			patch: `[{"op": "replace", "path": "/", "value": 2}]`,
+			want:  `{"": 2}`,
+		},
+		{
+			name:  "add a null value",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "add", "path": "/bar", "value": null}]`,
+			want:  `{"foo": 1, "bar": null}`,
+		},
+		{
+			name:  "test a null value",
+			doc:   `{"foo": null}`,
+			patch: `[{"op": "test", "path": "/foo", "value": null}]`,
+			want:  `{"foo": null}`,
+		},
+		{
+			name:  "missing value",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "add", "path": "/bar"}]`,
+		},
+		{
+			name:  "path without a leading slash",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "remove", "path": "foo"}]`,
+		},
+		{
+			name:  "replace a missing member",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "replace", "path": "/bar", "value": 2}]`,
+		},
+		{
+			name:  "unknown op",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "increment", "path": "/foo"}]`,
+		},
+		{
+			name:  "not an array",
+			doc:   `{"foo": 1}`,
+			patch: `{"op": "remove", "path": "/foo"}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := patch.Apply([]byte(tt.doc), []byte(tt.patch))
+			switch {
+			case tt.testFailure:
+				if !errors.Is(err, patch.ErrTestFailed) {
+					t.Fatalf("err = %v, want %v", err, patch.ErrTestFailed)
+				}
+			case tt.want == "":
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+			case err != nil:
+				t.Fatalf("err = %v", err)
+			case !jsonEqual(t, got, tt.want):
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyIsAtomic(t *testing.T) {
+	doc := []byte(`{"foo": ["a"]}`)
+	_, err := patch.Apply(doc, []byte(`[
+		{"op": "add", "path": "/foo/-", "value": "b"},
+		{"op": "remove", "path": "/missing"}
+	]`))
+	if err == nil {
+		t.Fatal("want an error from the second operation")
+	}
+	if string(doc) != `{"foo": ["a"]}` {
+		t.Fatalf("doc = %s, want it unchanged", doc)
+	}
+}
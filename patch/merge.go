@@ -0,0 +1,55 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON objects
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Media types of the two patch formats
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// Merge applies a JSON Merge Patch to the object doc: members of the patch
+// replace those of doc, objects are merged recursively and null removes a
+// member. Only object patches are accepted, since the result must still be
+// a document.
+func Merge(doc, mergePatch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+
+	var p interface{}
+	if err := json.Unmarshal(mergePatch, &p); err != nil {
+		return nil, errors.New("merge patch is not valid JSON")
+	}
+	if _, ok := p.(map[string]interface{}); !ok {
+		return nil, errors.New("merge patch must be a JSON object")
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, p interface{}) interface{} {
+	patchObject, ok := p.(map[string]interface{})
+	if !ok {
+		return p
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergeValue(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
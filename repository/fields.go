@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"bytes"
+	"cmp"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FieldIndex maps the BSON names of a struct's fields to their index,
+// following the driver's rules: the tag name, else the lowercased Go name
+func FieldIndex(t reflect.Type) map[string][]int {
+	index := map[string][]int{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("bson"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		index[name] = f.Index
+	}
+	return index
+}
+
+// documentFields reads and writes the fields of T by BSON name
+type documentFields[T any] struct {
+	index map[string][]int
+}
+
+func newDocumentFields[T any]() documentFields[T] {
+	return documentFields[T]{index: FieldIndex(reflect.TypeOf((*T)(nil)).Elem())}
+}
+
+func (f documentFields[T]) objectID(doc *T, name string) primitive.ObjectID {
+	id, _ := f.get(doc, name).Interface().(primitive.ObjectID)
+	return id
+}
+
+func (f documentFields[T]) get(doc *T, name string) reflect.Value {
+	return reflect.ValueOf(doc).Elem().FieldByIndex(f.index[name])
+}
+
+// apply performs a $set of the given fields on doc. Unknown fields are
+// ignored, matching a $set on a field the struct can't decode.
+func (f documentFields[T]) apply(doc *T, set map[string]interface{}) {
+	for name, value := range set {
+		if _, ok := f.index[name]; !ok {
+			continue
+		}
+		field := f.get(doc, name)
+		if value == nil {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+		v := reflect.ValueOf(value)
+		if v.Type().ConvertibleTo(field.Type()) {
+			field.Set(v.Convert(field.Type()))
+		}
+	}
+}
+
+// cursor returns the position of doc in a listing sorted by the given field
+func (f documentFields[T]) cursor(doc *T, sortField string) *Cursor {
+	c := &Cursor{ID: f.objectID(doc, "_id")}
+	if sortField != "_id" {
+		c.Value = f.get(doc, sortField).Interface()
+	}
+	return c
+}
+
+// compare orders two values of the same field the way MongoDB sorts them
+func compare(a, b interface{}) int {
+	switch x := a.(type) {
+	case primitive.ObjectID:
+		y, _ := b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:])
+	case time.Time:
+		y, _ := b.(time.Time)
+		return x.Compare(y)
+	}
+
+	x, y := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !x.IsValid() || !y.IsValid() || x.Type() != y.Type() {
+		return 0
+	}
+	switch x.Kind() {
+	case reflect.String:
+		return strings.Compare(x.String(), y.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp.Compare(x.Int(), y.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cmp.Compare(x.Uint(), y.Uint())
+	case reflect.Float32, reflect.Float64:
+		return cmp.Compare(x.Float(), y.Float())
+	case reflect.Bool:
+		if x.Bool() == y.Bool() {
+			return 0
+		}
+		if y.Bool() {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
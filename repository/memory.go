@@ -0,0 +1,918 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/search"
+)
+
+// NewMemoryStore returns empty, thread-safe in-memory repositories for tests
+// and local experiments
+func NewMemoryStore() *Store {
+	return &Store{
+		Books:              NewMemoryRepository[models.Book](TextFields["books"]),
+		Movies:             NewMemoryRepository[models.Movie](TextFields["movies"]),
+		Pets:               NewMemoryRepository[models.Pet](TextFields["pets"]),
+		Quotes:             NewMemoryRepository[models.Quote](TextFields["quotes"]),
+		Recipes:            NewMemoryRepository[models.Recipe](TextFields["recipes"]),
+		Travels:            NewMemoryRepository[models.TravelBuddy](TextFields["travels"]),
+		Users:              NewMemoryUserRepository(),
+		Sessions:           NewMemorySessionRepository(),
+		PasswordResets:     NewMemoryPasswordResetRepository(),
+		EmailVerifications: NewMemoryEmailVerificationRepository(),
+		APIKeys:            NewMemoryAPIKeyRepository(),
+		LoginAttempts:      NewMemoryLoginAttemptRepository(),
+		OIDCLogins:         NewMemoryOIDCLoginRepository(),
+		Audit:              NewMemoryAuditLog(),
+	}
+}
+
+// MemoryRepository keeps documents in insertion order, like a collection
+// read without a sort
+type MemoryRepository[T any] struct {
+	mu     sync.RWMutex
+	fields documentFields[T]
+	text   []TextField
+	docs   []T
+}
+
+// NewMemoryRepository returns an empty repository whose Search looks at the
+// given fields. It approximates MongoDB text search with package search.
+func NewMemoryRepository[T any](text []TextField) *MemoryRepository[T] {
+	return &MemoryRepository[T]{fields: newDocumentFields[T](), text: text}
+}
+
+func (r *MemoryRepository[T]) Insert(ctx context.Context, doc T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := r.fields.objectID(&doc, "_id")
+	if !id.IsZero() && r.indexOf(id) >= 0 {
+		return ErrDuplicate
+	}
+	r.docs = append(r.docs, doc)
+	return nil
+}
+
+func (r *MemoryRepository[T]) List(ctx context.Context, ownerID primitive.ObjectID, q ListQuery) (Page[T], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sortField := q.Sort
+	if sortField == "" {
+		sortField = "_id"
+	}
+	// position orders a document against a cursor, in listing order
+	position := func(doc *T, c *Cursor) int {
+		order := 0
+		if sortField != "_id" {
+			order = compare(r.fields.get(doc, sortField).Interface(), c.Value)
+		}
+		if order == 0 {
+			order = compare(r.fields.objectID(doc, "_id"), c.ID)
+		}
+		if q.Descending {
+			return -order
+		}
+		return order
+	}
+
+	var matched []T
+	for i := range r.docs {
+		if r.fields.objectID(&r.docs[i], "user_id") == ownerID && r.matches(&r.docs[i], q.Filter) {
+			matched = append(matched, r.docs[i])
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return position(&matched[i], r.fields.cursor(&matched[j], sortField)) < 0
+	})
+
+	page := Page[T]{Items: []T{}}
+	if q.Count {
+		page.Total = int64(len(matched))
+	}
+	for i := range matched {
+		if q.After != nil && position(&matched[i], q.After) <= 0 {
+			continue
+		}
+		if len(page.Items) == q.Limit {
+			page.Next = r.fields.cursor(&page.Items[len(page.Items)-1], sortField)
+			break
+		}
+		page.Items = append(page.Items, matched[i])
+	}
+	return page, nil
+}
+
+func (r *MemoryRepository[T]) matches(doc *T, conditions []Condition) bool {
+	for _, c := range conditions {
+		value := r.fields.get(doc, c.Field).Interface()
+		var ok bool
+		switch c.Op {
+		case OpEq:
+			ok = compare(value, c.Value) == 0
+		case OpNe:
+			ok = compare(value, c.Value) != 0
+		case OpGt:
+			ok = compare(value, c.Value) > 0
+		case OpGte:
+			ok = compare(value, c.Value) >= 0
+		case OpLt:
+			ok = compare(value, c.Value) < 0
+		case OpLte:
+			ok = compare(value, c.Value) <= 0
+		case OpIn:
+			candidates, _ := c.Value.([]interface{})
+			for _, candidate := range candidates {
+				if compare(value, candidate) == 0 {
+					ok = true
+					break
+				}
+			}
+		case OpContains:
+			s, _ := value.(string)
+			sub, _ := c.Value.(string)
+			ok = strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *MemoryRepository[T]) FindOwned(ctx context.Context, id, ownerID primitive.ObjectID) (T, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.indexOfOwned(id, ownerID)
+	if i < 0 {
+		var zero T
+		return zero, ErrNotFound
+	}
+	return r.docs[i], nil
+}
+
+func (r *MemoryRepository[T]) ReplaceOwned(ctx context.Context, id, ownerID primitive.ObjectID, version int64, doc T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, err := r.indexAtVersion(id, ownerID, version)
+	if err != nil {
+		return err
+	}
+	r.docs[i] = doc
+	return nil
+}
+
+func (r *MemoryRepository[T]) DeleteOwned(ctx context.Context, id, ownerID primitive.ObjectID, version int64) (T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, err := r.indexAtVersion(id, ownerID, version)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	doc := r.docs[i]
+	r.docs = append(r.docs[:i], r.docs[i+1:]...)
+	return doc, nil
+}
+
+func (r *MemoryRepository[T]) Search(ctx context.Context, ownerID primitive.ObjectID, query string, page, limit int) ([]Scored[T], int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	q := search.Parse(query)
+	results := []Scored[T]{}
+	for i := range r.docs {
+		if r.fields.objectID(&r.docs[i], "user_id") != ownerID {
+			continue
+		}
+		score, excluded := 0.0, false
+		for _, field := range r.text {
+			text, _ := r.fields.get(&r.docs[i], field.Name).Interface().(string)
+			matches, ex := q.Count(text)
+			excluded = excluded || ex
+			score += float64(field.Weight) * float64(matches)
+		}
+		if score > 0 && !excluded {
+			results = append(results, Scored[T]{Doc: r.docs[i], Score: score})
+		}
+	}
+	// Documents were inserted in ID order, so ties keep it
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return pageOf(results, page, limit), int64(len(results)), nil
+}
+
+func (r *MemoryRepository[T]) DeleteByOwner(ctx context.Context, ownerID primitive.ObjectID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	r.docs, n = deleteWhere(r.docs, func(doc T) bool { return r.fields.objectID(&doc, "user_id") == ownerID })
+	return n, nil
+}
+
+func (r *MemoryRepository[T]) indexAtVersion(id, ownerID primitive.ObjectID, version int64) (int, error) {
+	i := r.indexOfOwned(id, ownerID)
+	if i < 0 {
+		return -1, ErrNotFound
+	}
+	if version != AnyVersion && r.fields.get(&r.docs[i], "version").Int() != version {
+		return -1, ErrVersionConflict
+	}
+	return i, nil
+}
+
+func (r *MemoryRepository[T]) indexOf(id primitive.ObjectID) int {
+	for i := range r.docs {
+		if r.fields.objectID(&r.docs[i], "_id") == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *MemoryRepository[T]) indexOfOwned(id, ownerID primitive.ObjectID) int {
+	i := r.indexOf(id)
+	if i < 0 || r.fields.objectID(&r.docs[i], "user_id") != ownerID {
+		return -1
+	}
+	return i
+}
+
+// MemoryUserRepository keeps accounts in a map keyed by ID
+type MemoryUserRepository struct {
+	mu     sync.RWMutex
+	fields documentFields[models.User]
+	users  map[primitive.ObjectID]models.User
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		fields: newDocumentFields[models.User](),
+		users:  map[primitive.ObjectID]models.User{},
+	}
+}
+
+func (r *MemoryUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *MemoryUserRepository) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, strings.TrimSpace(email)) {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *MemoryUserRepository) FindByExternalIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if hasIdentity(user, issuer, subject) {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *MemoryUserRepository) Insert(ctx context.Context, user models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.users[user.ID]; exists || r.emailTaken(user.Email, user.ID) {
+		return ErrDuplicate
+	}
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, id primitive.ObjectID, set map[string]interface{}) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, ok := r.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+
+	after := before
+	r.fields.apply(&after, set)
+	if r.emailTaken(after.Email, id) {
+		return models.User{}, ErrDuplicate
+	}
+	r.users[id] = after
+	return before, nil
+}
+
+func (r *MemoryUserRepository) ReplacePassword(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	return r.modify(id, func(user *models.User) bool {
+		if user.Password != oldHash {
+			return false
+		}
+		user.Password = newHash
+		return true
+	})
+}
+
+func (r *MemoryUserRepository) MarkVerified(ctx context.Context, id primitive.ObjectID, email string) error {
+	return r.modify(id, func(user *models.User) bool {
+		if user.Email != email {
+			return false
+		}
+		user.Verified = true
+		return true
+	})
+}
+
+func (r *MemoryUserRepository) LinkExternalIdentity(ctx context.Context, id primitive.ObjectID, identity models.ExternalIdentity) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	for _, other := range r.users {
+		if hasIdentity(other, identity.Issuer, identity.Subject) {
+			return models.User{}, ErrDuplicate
+		}
+	}
+	user.ExternalIdentities = append(slices.Clone(user.ExternalIdentities), identity)
+	r.users[id] = user
+	return user, nil
+}
+
+func (r *MemoryUserRepository) AdvanceTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error) {
+	return r.modified(id, func(user *models.User) bool {
+		if user.TOTPLastStep >= step {
+			return false
+		}
+		user.TOTPLastStep = step
+		return true
+	})
+}
+
+func (r *MemoryUserRepository) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) (bool, error) {
+	return r.modified(id, func(user *models.User) bool {
+		i := slices.Index(user.RecoveryCodes, hash)
+		if i < 0 {
+			return false
+		}
+		user.RecoveryCodes = slices.Delete(slices.Clone(user.RecoveryCodes), i, i+1)
+		return true
+	})
+}
+
+// modify changes the user with change, which reports whether the user still
+// matched. Returns ErrNotFound when the user is missing or didn't match.
+func (r *MemoryUserRepository) modify(id primitive.ObjectID, change func(user *models.User) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || !change(&user) {
+		return ErrNotFound
+	}
+	r.users[id] = user
+	return nil
+}
+
+// modified is modify for changes that report a mismatch as false rather
+// than as an error
+func (r *MemoryUserRepository) modified(id primitive.ObjectID, change func(user *models.User) bool) (bool, error) {
+	err := r.modify(id, change)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context, query string, page, limit int) ([]models.User, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	matched := []models.User{}
+	for _, user := range r.users {
+		if query == "" ||
+			strings.Contains(strings.ToLower(user.Name), query) ||
+			strings.Contains(strings.ToLower(user.Email), query) {
+			user.Password = ""
+			matched = append(matched, user)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].ID.Hex() < matched[j].ID.Hex()
+	})
+
+	return pageOf(matched, page, limit), int64(len(matched)), nil
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return 0, nil
+	}
+	delete(r.users, id)
+	return 1, nil
+}
+
+func (r *MemoryUserRepository) emailTaken(email string, exceptID primitive.ObjectID) bool {
+	for id, user := range r.users {
+		if id != exceptID && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasIdentity(user models.User, issuer, subject string) bool {
+	return slices.ContainsFunc(user.ExternalIdentities, func(identity models.ExternalIdentity) bool {
+		return identity.Issuer == issuer && identity.Subject == subject
+	})
+}
+
+// MemorySessionRepository keeps sessions in insertion order
+type MemorySessionRepository struct {
+	mu       sync.Mutex
+	sessions []models.Session
+	revoked  map[primitive.ObjectID]int
+}
+
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{revoked: map[primitive.ObjectID]int{}}
+}
+
+func (r *MemorySessionRepository) Insert(ctx context.Context, session models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sessions = append(r.sessions, session)
+	return nil
+}
+
+func (r *MemorySessionRepository) Claim(ctx context.Context, tokenHash string, now time.Time) (models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.sessions {
+		s := &r.sessions[i]
+		if s.TokenHash == tokenHash && s.UsedAt == nil && s.RevokedAt == nil && s.ExpiresAt.After(now) {
+			s.UsedAt = &now
+			return *s, nil
+		}
+	}
+	return models.Session{}, ErrNotFound
+}
+
+func (r *MemorySessionRepository) FindByToken(ctx context.Context, tokenHash string) (models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.sessions {
+		if s.TokenHash == tokenHash {
+			return s, nil
+		}
+	}
+	return models.Session{}, ErrNotFound
+}
+
+func (r *MemorySessionRepository) FamilyActive(ctx context.Context, userID, familyID primitive.ObjectID, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.FamilyID == familyID && s.RevokedAt == nil && s.ExpiresAt.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemorySessionRepository) RevokeFamily(ctx context.Context, userID, familyID primitive.ObjectID) (int64, error) {
+	return r.revoke(func(s models.Session) bool {
+		return s.UserID == userID && s.FamilyID == familyID
+	}), nil
+}
+
+func (r *MemorySessionRepository) RevokeAll(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	r.mu.Lock()
+	r.revoked[userID]++
+	r.mu.Unlock()
+
+	return r.revoke(func(s models.Session) bool {
+		return s.UserID == userID
+	}), nil
+}
+
+func (r *MemorySessionRepository) RevokeOthers(ctx context.Context, userID, keepFamilyID primitive.ObjectID) (int64, error) {
+	return r.revoke(func(s models.Session) bool {
+		return s.UserID == userID && s.FamilyID != keepFamilyID
+	}), nil
+}
+
+// revoke revokes the matching sessions that aren't revoked yet and reports
+// how many
+func (r *MemorySessionRepository) revoke(match func(s models.Session) bool) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var n int64
+	for i := range r.sessions {
+		if r.sessions[i].RevokedAt == nil && match(r.sessions[i]) {
+			r.sessions[i].RevokedAt = &now
+			n++
+		}
+	}
+	return n
+}
+
+func (r *MemorySessionRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	r.sessions, n = deleteWhere(r.sessions, func(s models.Session) bool { return s.UserID == userID })
+	return n, nil
+}
+
+// Revocations reports how many times RevokeAll was called for a user
+func (r *MemorySessionRepository) Revocations(userID primitive.ObjectID) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.revoked[userID]
+}
+
+// MemoryPasswordResetRepository keeps reset tokens in insertion order
+type MemoryPasswordResetRepository struct {
+	mu     sync.Mutex
+	resets []models.PasswordReset
+}
+
+func NewMemoryPasswordResetRepository() *MemoryPasswordResetRepository {
+	return &MemoryPasswordResetRepository{}
+}
+
+func (r *MemoryPasswordResetRepository) Insert(ctx context.Context, reset models.PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resets = append(r.resets, reset)
+	return nil
+}
+
+func (r *MemoryPasswordResetRepository) Consume(ctx context.Context, tokenHash string, now time.Time) (models.PasswordReset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.resets {
+		reset := &r.resets[i]
+		if reset.TokenHash == tokenHash && reset.UsedAt == nil && reset.ExpiresAt.After(now) {
+			reset.UsedAt = &now
+			return *reset, nil
+		}
+	}
+	return models.PasswordReset{}, ErrNotFound
+}
+
+func (r *MemoryPasswordResetRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	r.resets, n = deleteWhere(r.resets, func(reset models.PasswordReset) bool { return reset.UserID == userID })
+	return n, nil
+}
+
+// MemoryEmailVerificationRepository keeps verification tokens in insertion
+// order
+type MemoryEmailVerificationRepository struct {
+	mu            sync.Mutex
+	verifications []models.EmailVerification
+}
+
+func NewMemoryEmailVerificationRepository() *MemoryEmailVerificationRepository {
+	return &MemoryEmailVerificationRepository{}
+}
+
+func (r *MemoryEmailVerificationRepository) Insert(ctx context.Context, verification models.EmailVerification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.verifications = append(r.verifications, verification)
+	return nil
+}
+
+func (r *MemoryEmailVerificationRepository) Consume(ctx context.Context, tokenHash string, now time.Time) (models.EmailVerification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, v := range r.verifications {
+		if v.TokenHash == tokenHash && v.ExpiresAt.After(now) {
+			r.verifications = slices.Delete(r.verifications, i, i+1)
+			return v, nil
+		}
+	}
+	return models.EmailVerification{}, ErrNotFound
+}
+
+func (r *MemoryEmailVerificationRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	r.verifications, n = deleteWhere(r.verifications, func(v models.EmailVerification) bool { return v.UserID == userID })
+	return n, nil
+}
+
+// MemoryAPIKeyRepository keeps API keys in insertion order
+type MemoryAPIKeyRepository struct {
+	mu   sync.Mutex
+	keys []models.APIKey
+}
+
+func NewMemoryAPIKeyRepository() *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{}
+}
+
+func (r *MemoryAPIKeyRepository) Insert(ctx context.Context, key models.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.KeyHash == key.KeyHash {
+			return ErrDuplicate
+		}
+	}
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	keys, err := r.ListByUser(ctx, userID)
+	return int64(len(keys)), err
+}
+
+func (r *MemoryAPIKeyRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := []models.APIKey{}
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if r.keys[i].UserID == userID {
+			keys = append(keys, r.keys[i])
+		}
+	}
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepository) FindActive(ctx context.Context, keyHash string, now time.Time) (models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.KeyHash == keyHash && (k.ExpiresAt == nil || k.ExpiresAt.After(now)) {
+			return k, nil
+		}
+	}
+	return models.APIKey{}, ErrNotFound
+}
+
+func (r *MemoryAPIKeyRepository) MarkUsed(ctx context.Context, id primitive.ObjectID, now, since time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.keys {
+		k := &r.keys[i]
+		if k.ID == id && (k.LastUsedAt == nil || k.LastUsedAt.Before(since)) {
+			k.LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) DeleteOwned(ctx context.Context, id, userID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	r.keys, n = deleteWhere(r.keys, func(k models.APIKey) bool { return k.ID == id && k.UserID == userID })
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	r.keys, n = deleteWhere(r.keys, func(k models.APIKey) bool { return k.UserID == userID })
+	return n, nil
+}
+
+// MemoryLoginAttemptRepository keeps failed login counts in a map keyed
+// like the attempts themselves
+type MemoryLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempt
+	lockouts []models.LoginLockout
+}
+
+func NewMemoryLoginAttemptRepository() *MemoryLoginAttemptRepository {
+	return &MemoryLoginAttemptRepository{attempts: map[string]models.LoginAttempt{}}
+}
+
+func (r *MemoryLoginAttemptRepository) FindLocked(ctx context.Context, now time.Time, keys ...string) ([]models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	locked := []models.LoginAttempt{}
+	for _, key := range keys {
+		if attempt, ok := r.attempts[key]; ok && attempt.LockedUntil.After(now) {
+			locked = append(locked, attempt)
+		}
+	}
+	return locked, nil
+}
+
+func (r *MemoryLoginAttemptRepository) RecordFailure(ctx context.Context, key string, now time.Time, window, retention time.Duration) (models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.attempts[key]
+	if !ok || !attempt.LastFailureAt.After(now.Add(-window)) {
+		attempt.Failures = 0
+	}
+	attempt.Key = key
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	attempt.ExpiresAt = now.Add(retention)
+	r.attempts[key] = attempt
+	return attempt, nil
+}
+
+func (r *MemoryLoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if attempt, ok := r.attempts[key]; ok {
+		attempt.LockedUntil = until
+		r.attempts[key] = attempt
+	}
+	return nil
+}
+
+func (r *MemoryLoginAttemptRepository) Clear(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+	return nil
+}
+
+func (r *MemoryLoginAttemptRepository) InsertLockout(ctx context.Context, lockout models.LoginLockout) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lockouts = append(r.lockouts, lockout)
+	return nil
+}
+
+// MemoryOIDCLoginRepository keeps pending external sign-ins in insertion
+// order
+type MemoryOIDCLoginRepository struct {
+	mu     sync.Mutex
+	logins []models.OIDCLogin
+}
+
+func NewMemoryOIDCLoginRepository() *MemoryOIDCLoginRepository {
+	return &MemoryOIDCLoginRepository{}
+}
+
+func (r *MemoryOIDCLoginRepository) Insert(ctx context.Context, login models.OIDCLogin) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.logins = append(r.logins, login)
+	return nil
+}
+
+func (r *MemoryOIDCLoginRepository) Consume(ctx context.Context, stateHash string, now time.Time) (models.OIDCLogin, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, login := range r.logins {
+		if login.StateHash == stateHash && login.ExpiresAt.After(now) {
+			r.logins = slices.Delete(r.logins, i, i+1)
+			return login, nil
+		}
+	}
+	return models.OIDCLogin{}, ErrNotFound
+}
+
+// deleteWhere removes the items matching match and reports how many
+func deleteWhere[T any](items []T, match func(item T) bool) ([]T, int64) {
+	kept := slices.DeleteFunc(items, match)
+	return kept, int64(len(items) - len(kept))
+}
+
+// MemoryAuditLog keeps audit events in the order they were recorded
+type MemoryAuditLog struct {
+	mu     sync.RWMutex
+	events []models.AuditEvent
+}
+
+func NewMemoryAuditLog() *MemoryAuditLog {
+	return &MemoryAuditLog{}
+}
+
+func (l *MemoryAuditLog) Insert(ctx context.Context, event models.AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, event)
+	return nil
+}
+
+func (l *MemoryAuditLog) List(ctx context.Context, query AuditQuery, page, limit int) ([]models.AuditEvent, int64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	matched := []models.AuditEvent{}
+	for i := len(l.events) - 1; i >= 0; i-- {
+		if matchesAudit(l.events[i], query) {
+			matched = append(matched, l.events[i])
+		}
+	}
+
+	return pageOf(matched, page, limit), int64(len(matched)), nil
+}
+
+func matchesAudit(e models.AuditEvent, q AuditQuery) bool {
+	if q.Involving != nil && !sameID(e.UserID, q.Involving) && !sameID(e.ActorID, q.Involving) {
+		return false
+	}
+	if (q.Action != "" && e.Action != q.Action) ||
+		(q.TargetType != "" && e.TargetType != q.TargetType) ||
+		(q.IP != "" && e.IP != q.IP) ||
+		(q.RequestID != "" && e.RequestID != q.RequestID) {
+		return false
+	}
+	if (q.UserID != nil && !sameID(e.UserID, q.UserID)) ||
+		(q.ActorID != nil && !sameID(e.ActorID, q.ActorID)) ||
+		(q.TargetID != nil && !sameID(e.TargetID, q.TargetID)) {
+		return false
+	}
+	if (q.From != nil && e.CreatedAt.Before(*q.From)) || (q.To != nil && e.CreatedAt.After(*q.To)) {
+		return false
+	}
+	return true
+}
+
+func sameID(a, b *primitive.ObjectID) bool {
+	return a != nil && b != nil && *a == *b
+}
+
+func pageOf[T any](items []T, page, limit int) []T {
+	start := (page - 1) * limit
+	if start >= len(items) {
+		return []T{}
+	}
+	end := start + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
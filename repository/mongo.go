@@ -0,0 +1,953 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kashyapprajapat/collecthub_api/models"
+)
+
+// emailCollation compares emails case-insensitively, like the unique email
+// index on users
+var emailCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// NewMongoStore returns repositories backed by db and makes sure the
+// indexes they rely on exist. It fails when one of the indexes enforcing
+// uniqueness can't be built, rather than running without the guarantee.
+func NewMongoStore(db *mongo.Database) (*Store, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, name := range CollectionNames {
+		// Text queries must name the owner, so searches stay within one
+		// user's documents and only scan that part of the index
+		text := bson.D{{Key: "user_id", Value: 1}}
+		weights := bson.D{}
+		for _, field := range TextFields[name] {
+			text = append(text, bson.E{Key: field.Name, Value: "text"})
+			weights = append(weights, bson.E{Key: field.Name, Value: field.Weight})
+		}
+
+		_, err := db.Collection(name).Indexes().CreateMany(ctx, []mongo.IndexModel{
+			// Serves the default listing order as well as lookups by owner
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: 1}}},
+			// Serves the feed and "recently added" listings
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+			{Keys: text, Options: options.Index().SetName("text_search").SetWeights(weights)},
+		})
+		if err != nil {
+			log.Printf("Failed to create %s indexes: %v", name, err)
+		}
+
+		// Documents stored before they had timestamps were created when
+		// their ID was generated
+		_, err = db.Collection(name).UpdateMany(ctx, bson.M{"created_at": bson.M{"$exists": false}}, mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"created_at": bson.M{"$toDate": "$_id"},
+				"updated_at": bson.M{"$toDate": "$_id"},
+				"version":    1,
+			}}},
+		})
+		if err != nil {
+			log.Printf("Failed to add timestamps to %s: %v", name, err)
+		}
+	}
+
+	// Expired tokens are useless, so MongoDB cleans them up
+	expires := mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)}
+	for _, index := range []struct {
+		collection string
+		models     []mongo.IndexModel
+	}{
+		{"users", []mongo.IndexModel{
+			// One account per address, compared case-insensitively. The
+			// database enforces this so concurrent signups can't both succeed.
+			{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().
+				SetName("email_unique_ci").
+				SetUnique(true).
+				SetCollation(emailCollation)},
+			// An external subject belongs to exactly one account. Sparse so
+			// accounts without linked identities don't collide with each other.
+			{Keys: bson.D{
+				{Key: "external_identities.issuer", Value: 1},
+				{Key: "external_identities.subject", Value: 1},
+			}, Options: options.Index().SetName("external_identity_unique").SetUnique(true).SetSparse(true)},
+		}},
+		{"sessions", []mongo.IndexModel{
+			{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "family_id", Value: 1}}},
+			{Keys: bson.D{{Key: "user_id", Value: 1}}},
+			expires,
+		}},
+		{"password_resets", []mongo.IndexModel{
+			{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}}},
+			expires,
+		}},
+		{"email_verifications", []mongo.IndexModel{
+			{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}}},
+			expires,
+		}},
+		{"api_keys", []mongo.IndexModel{
+			{Keys: bson.D{{Key: "key_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		}},
+		{"login_attempts", []mongo.IndexModel{expires}},
+		{"oidc_logins", []mongo.IndexModel{
+			{Keys: bson.D{{Key: "state_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			expires,
+		}},
+		{"audit_events", []mongo.IndexModel{
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "action", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		}},
+	} {
+		_, err := db.Collection(index.collection).Indexes().CreateMany(ctx, index.models)
+		if index.collection == "users" && mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("users holds accounts whose emails differ only in case, merge or remove them before starting: %w", err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("create %s indexes: %w", index.collection, err)
+		}
+	}
+
+	return &Store{
+		Books:              NewMongoRepository[models.Book](db.Collection("books")),
+		Movies:             NewMongoRepository[models.Movie](db.Collection("movies")),
+		Pets:               NewMongoRepository[models.Pet](db.Collection("pets")),
+		Quotes:             NewMongoRepository[models.Quote](db.Collection("quotes")),
+		Recipes:            NewMongoRepository[models.Recipe](db.Collection("recipes")),
+		Travels:            NewMongoRepository[models.TravelBuddy](db.Collection("travels")),
+		Users:              NewMongoUserRepository(db.Collection("users")),
+		Sessions:           NewMongoSessionRepository(db.Collection("sessions")),
+		PasswordResets:     NewMongoPasswordResetRepository(db.Collection("password_resets")),
+		EmailVerifications: NewMongoEmailVerificationRepository(db.Collection("email_verifications")),
+		APIKeys:            NewMongoAPIKeyRepository(db.Collection("api_keys")),
+		LoginAttempts:      NewMongoLoginAttemptRepository(db.Collection("login_attempts"), db.Collection("login_lockouts")),
+		OIDCLogins:         NewMongoOIDCLoginRepository(db.Collection("oidc_logins")),
+		Audit:              NewMongoAuditLog(db.Collection("audit_events")),
+		transact: func(ctx context.Context, fn func(context.Context) error) error {
+			return withTransaction(ctx, db.Client(), fn)
+		},
+	}, nil
+}
+
+// withTransaction runs fn in a transaction. Standalone servers don't
+// support transactions, so there fn runs without one.
+func withTransaction(ctx context.Context, client *mongo.Client, fn func(context.Context) error) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	if err != nil && transactionsUnsupported(err) {
+		log.Printf("Transactions unavailable, continuing without one")
+		return fn(ctx)
+	}
+	return err
+}
+
+// transactionsUnsupported reports whether the server rejected the
+// transaction because it is a standalone instance
+func transactionsUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 20 { // IllegalOperation
+		return true
+	}
+	return strings.Contains(err.Error(), "Transaction numbers are only allowed")
+}
+
+type mongoRepository[T any] struct {
+	collection *mongo.Collection
+	fields     documentFields[T]
+}
+
+// NewMongoRepository stores documents of type T in collection
+func NewMongoRepository[T any](collection *mongo.Collection) Repository[T] {
+	return &mongoRepository[T]{collection: collection, fields: newDocumentFields[T]()}
+}
+
+func (r *mongoRepository[T]) Insert(ctx context.Context, doc T) error {
+	_, err := r.collection.InsertOne(ctx, doc)
+	return err
+}
+
+func (r *mongoRepository[T]) List(ctx context.Context, ownerID primitive.ObjectID, q ListQuery) (Page[T], error) {
+	sortField := q.Sort
+	if sortField == "" {
+		sortField = "_id"
+	}
+	direction, past := 1, "$gt"
+	if q.Descending {
+		direction, past = -1, "$lt"
+	}
+
+	match := matchConditions(bson.M{"user_id": ownerID}, q.Filter)
+	filter := bson.M{}
+	for key, value := range match {
+		filter[key] = value
+	}
+	if q.After != nil {
+		if sortField == "_id" {
+			filter["_id"] = bson.M{past: q.After.ID}
+		} else {
+			filter["$or"] = bson.A{
+				bson.M{sortField: bson.M{past: q.After.Value}},
+				bson.M{sortField: q.After.Value, "_id": bson.M{past: q.After.ID}},
+			}
+		}
+	}
+
+	order := bson.D{{Key: sortField, Value: direction}}
+	if sortField != "_id" {
+		order = append(order, bson.E{Key: "_id", Value: direction})
+	}
+	// One extra document tells whether another page follows
+	opts := options.Find().SetSort(order).SetLimit(int64(q.Limit) + 1)
+	if len(q.Fields) > 0 {
+		// The ID and sort field are needed for the next page's cursor
+		projection := bson.M{"_id": 1, sortField: 1}
+		for _, field := range q.Fields {
+			projection[field] = 1
+		}
+		opts.SetProjection(projection)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	docs := []T{}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return Page[T]{}, err
+	}
+
+	page := Page[T]{Items: docs}
+	if len(docs) > q.Limit {
+		page.Items = docs[:q.Limit]
+		page.Next = r.fields.cursor(&page.Items[q.Limit-1], sortField)
+	}
+	if q.Count {
+		if page.Total, err = r.collection.CountDocuments(ctx, match); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	return page, nil
+}
+
+func (r *mongoRepository[T]) FindOwned(ctx context.Context, id, ownerID primitive.ObjectID) (T, error) {
+	var doc T
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "user_id": ownerID}).Decode(&doc)
+	return doc, notFound(err)
+}
+
+func (r *mongoRepository[T]) ReplaceOwned(ctx context.Context, id, ownerID primitive.ObjectID, version int64, doc T) error {
+	result, err := r.collection.ReplaceOne(ctx, versionFilter(id, ownerID, version), doc)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return r.missingOrChanged(ctx, id, ownerID)
+	}
+	return nil
+}
+
+func (r *mongoRepository[T]) DeleteOwned(ctx context.Context, id, ownerID primitive.ObjectID, version int64) (T, error) {
+	var doc T
+	err := r.collection.FindOneAndDelete(ctx, versionFilter(id, ownerID, version)).Decode(&doc)
+	if err == mongo.ErrNoDocuments && version != AnyVersion {
+		return doc, r.missingOrChanged(ctx, id, ownerID)
+	}
+	return doc, notFound(err)
+}
+
+// missingOrChanged tells why a write conditional on the version matched
+// nothing
+func (r *mongoRepository[T]) missingOrChanged(ctx context.Context, id, ownerID primitive.ObjectID) error {
+	n, err := r.collection.CountDocuments(ctx, bson.M{"_id": id, "user_id": ownerID})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
+
+// versionFilter matches the owner's document at version, or at any version
+// for AnyVersion
+func versionFilter(id, ownerID primitive.ObjectID, version int64) bson.M {
+	filter := bson.M{"_id": id, "user_id": ownerID}
+	switch version {
+	case AnyVersion:
+	case 0:
+		// Not versioned yet, if the timestamps couldn't be backfilled
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	default:
+		filter["version"] = version
+	}
+	return filter
+}
+
+// matchConditions adds the conditions to filter. Operators and fields come
+// from the Condition, never from user input, so nothing can be injected.
+func matchConditions(filter bson.M, conditions []Condition) bson.M {
+	var and bson.A
+	for _, c := range conditions {
+		op, value := "$"+c.Op, c.Value
+		if c.Op == OpContains {
+			s, _ := c.Value.(string)
+			op, value = "$regex", primitive.Regex{Pattern: regexp.QuoteMeta(s), Options: "i"}
+		}
+
+		ops, ok := filter[c.Field].(bson.M)
+		if !ok {
+			ops = bson.M{}
+			filter[c.Field] = ops
+		}
+		// A second use of an operator on the field would replace the first
+		// one, so it's matched separately, like the memory store does
+		if _, taken := ops[op]; taken {
+			and = append(and, bson.M{c.Field: bson.M{op: value}})
+			continue
+		}
+		ops[op] = value
+	}
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+	return filter
+}
+
+// textScore is the field search results carry their relevance in
+const textScore = "_score"
+
+func (r *mongoRepository[T]) Search(ctx context.Context, ownerID primitive.ObjectID, query string, page, limit int) ([]Scored[T], int64, error) {
+	filter := bson.M{"user_id": ownerID, "$text": bson.M{"$search": query}}
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{textScore: score}).
+		SetSort(bson.D{{Key: textScore, Value: score}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []Scored[T]{}
+	for cursor.Next(ctx) {
+		var result Scored[T]
+		if err := cursor.Decode(&result.Doc); err != nil {
+			return nil, 0, err
+		}
+		result.Score, _ = cursor.Current.Lookup(textScore).DoubleOK()
+		results = append(results, result)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+func (r *mongoRepository[T]) DeleteByOwner(ctx context.Context, ownerID primitive.ObjectID) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"user_id": ownerID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+type mongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoUserRepository stores accounts in collection
+func NewMongoUserRepository(collection *mongo.Collection) UserRepository {
+	return &mongoUserRepository{collection: collection}
+}
+
+func (r *mongoUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	var user models.User
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	return user, notFound(err)
+}
+
+func (r *mongoUserRepository) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	err := r.collection.FindOne(
+		ctx,
+		bson.M{"email": strings.TrimSpace(email)},
+		options.FindOne().SetCollation(emailCollation),
+	).Decode(&user)
+	return user, notFound(err)
+}
+
+func (r *mongoUserRepository) FindByExternalIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	var user models.User
+	err := r.collection.FindOne(ctx, bson.M{
+		"external_identities": bson.M{"$elemMatch": bson.M{"issuer": issuer, "subject": subject}},
+	}).Decode(&user)
+	return user, notFound(err)
+}
+
+func (r *mongoUserRepository) Insert(ctx context.Context, user models.User) error {
+	_, err := r.collection.InsertOne(ctx, user)
+	return duplicate(err)
+}
+
+func (r *mongoUserRepository) Update(ctx context.Context, id primitive.ObjectID, set map[string]interface{}) (models.User, error) {
+	var before models.User
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, setOrUnset(set)).Decode(&before)
+	return before, duplicate(notFound(err))
+}
+
+// setOrUnset turns fields to set into an update document, unsetting the
+// ones set to nil
+func setOrUnset(fields map[string]interface{}) bson.M {
+	set, unset := bson.M{}, bson.M{}
+	for key, value := range fields {
+		if value == nil {
+			unset[key] = ""
+		} else {
+			set[key] = value
+		}
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
+func (r *mongoUserRepository) ReplacePassword(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	return r.updateOne(ctx, bson.M{"_id": id, "password": oldHash}, bson.M{"$set": bson.M{"password": newHash}})
+}
+
+func (r *mongoUserRepository) MarkVerified(ctx context.Context, id primitive.ObjectID, email string) error {
+	return r.updateOne(ctx, bson.M{"_id": id, "email": email}, bson.M{"$set": bson.M{"verified": true}})
+}
+
+func (r *mongoUserRepository) LinkExternalIdentity(ctx context.Context, id primitive.ObjectID, identity models.ExternalIdentity) (models.User, error) {
+	var user models.User
+	err := r.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$push": bson.M{"external_identities": identity}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	return user, duplicate(notFound(err))
+}
+
+func (r *mongoUserRepository) AdvanceTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error) {
+	err := r.updateOne(
+		ctx,
+		bson.M{"_id": id, "$or": bson.A{
+			bson.M{"totp_last_step": bson.M{"$lt": step}},
+			bson.M{"totp_last_step": bson.M{"$exists": false}},
+		}},
+		bson.M{"$set": bson.M{"totp_last_step": step}},
+	)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *mongoUserRepository) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) (bool, error) {
+	err := r.updateOne(
+		ctx,
+		bson.M{"_id": id, "recovery_codes": hash},
+		bson.M{"$pull": bson.M{"recovery_codes": hash}},
+	)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// updateOne applies update to the user matching filter, returning
+// ErrNotFound when none does
+func (r *mongoUserRepository) updateOne(ctx context.Context, filter, update bson.M) error {
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) List(ctx context.Context, query string, page, limit int) ([]models.User, int64, error) {
+	filter := bson.M{}
+	if query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}
+		filter["$or"] = bson.A{
+			bson.M{"name": pattern},
+			bson.M{"email": pattern},
+		}
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"password": 0})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *mongoUserRepository) Delete(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+type mongoSessionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoSessionRepository manages the refresh token sessions in collection
+func NewMongoSessionRepository(collection *mongo.Collection) SessionRepository {
+	return &mongoSessionRepository{collection: collection}
+}
+
+func (r *mongoSessionRepository) Insert(ctx context.Context, session models.Session) error {
+	_, err := r.collection.InsertOne(ctx, session)
+	return err
+}
+
+func (r *mongoSessionRepository) Claim(ctx context.Context, tokenHash string, now time.Time) (models.Session, error) {
+	var session models.Session
+	err := r.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"token_hash": tokenHash,
+			"used_at":    bson.M{"$exists": false},
+			"revoked_at": bson.M{"$exists": false},
+			"expires_at": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&session)
+	return session, notFound(err)
+}
+
+func (r *mongoSessionRepository) FindByToken(ctx context.Context, tokenHash string) (models.Session, error) {
+	var session models.Session
+	err := r.collection.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&session)
+	return session, notFound(err)
+}
+
+func (r *mongoSessionRepository) FamilyActive(ctx context.Context, userID, familyID primitive.ObjectID, now time.Time) (bool, error) {
+	err := r.collection.FindOne(
+		ctx,
+		bson.M{
+			"family_id":  familyID,
+			"user_id":    userID,
+			"revoked_at": bson.M{"$exists": false},
+			"expires_at": bson.M{"$gt": now},
+		},
+		options.FindOne().SetProjection(bson.M{"_id": 1}),
+	).Err()
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *mongoSessionRepository) RevokeFamily(ctx context.Context, userID, familyID primitive.ObjectID) (int64, error) {
+	return r.revoke(ctx, bson.M{"user_id": userID, "family_id": familyID})
+}
+
+func (r *mongoSessionRepository) RevokeAll(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return r.revoke(ctx, bson.M{"user_id": userID})
+}
+
+func (r *mongoSessionRepository) RevokeOthers(ctx context.Context, userID, keepFamilyID primitive.ObjectID) (int64, error) {
+	return r.revoke(ctx, bson.M{"user_id": userID, "family_id": bson.M{"$ne": keepFamilyID}})
+}
+
+// revoke revokes the sessions matching filter that aren't revoked yet
+func (r *mongoSessionRepository) revoke(ctx context.Context, filter bson.M) (int64, error) {
+	filter["revoked_at"] = bson.M{"$exists": false}
+	result, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoSessionRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return deleteByUser(ctx, r.collection, userID)
+}
+
+type mongoPasswordResetRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoPasswordResetRepository stores password reset tokens in collection
+func NewMongoPasswordResetRepository(collection *mongo.Collection) PasswordResetRepository {
+	return &mongoPasswordResetRepository{collection: collection}
+}
+
+func (r *mongoPasswordResetRepository) Insert(ctx context.Context, reset models.PasswordReset) error {
+	_, err := r.collection.InsertOne(ctx, reset)
+	return err
+}
+
+func (r *mongoPasswordResetRepository) Consume(ctx context.Context, tokenHash string, now time.Time) (models.PasswordReset, error) {
+	var reset models.PasswordReset
+	err := r.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"token_hash": tokenHash,
+			"used_at":    bson.M{"$exists": false},
+			"expires_at": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&reset)
+	return reset, notFound(err)
+}
+
+func (r *mongoPasswordResetRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return deleteByUser(ctx, r.collection, userID)
+}
+
+type mongoEmailVerificationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoEmailVerificationRepository stores email verification tokens in
+// collection
+func NewMongoEmailVerificationRepository(collection *mongo.Collection) EmailVerificationRepository {
+	return &mongoEmailVerificationRepository{collection: collection}
+}
+
+func (r *mongoEmailVerificationRepository) Insert(ctx context.Context, verification models.EmailVerification) error {
+	_, err := r.collection.InsertOne(ctx, verification)
+	return err
+}
+
+func (r *mongoEmailVerificationRepository) Consume(ctx context.Context, tokenHash string, now time.Time) (models.EmailVerification, error) {
+	var verification models.EmailVerification
+	err := r.collection.FindOneAndDelete(ctx, bson.M{
+		"token_hash": tokenHash,
+		"expires_at": bson.M{"$gt": now},
+	}).Decode(&verification)
+	return verification, notFound(err)
+}
+
+func (r *mongoEmailVerificationRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return deleteByUser(ctx, r.collection, userID)
+}
+
+type mongoAPIKeyRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAPIKeyRepository stores API keys in collection
+func NewMongoAPIKeyRepository(collection *mongo.Collection) APIKeyRepository {
+	return &mongoAPIKeyRepository{collection: collection}
+}
+
+func (r *mongoAPIKeyRepository) Insert(ctx context.Context, key models.APIKey) error {
+	_, err := r.collection.InsertOne(ctx, key)
+	return duplicate(err)
+}
+
+func (r *mongoAPIKeyRepository) CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+}
+
+func (r *mongoAPIKeyRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error) {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *mongoAPIKeyRepository) FindActive(ctx context.Context, keyHash string, now time.Time) (models.APIKey, error) {
+	var key models.APIKey
+	err := r.collection.FindOne(ctx, bson.M{
+		"key_hash": keyHash,
+		"$or": bson.A{
+			bson.M{"expires_at": bson.M{"$exists": false}},
+			bson.M{"expires_at": bson.M{"$gt": now}},
+		},
+	}).Decode(&key)
+	return key, notFound(err)
+}
+
+func (r *mongoAPIKeyRepository) MarkUsed(ctx context.Context, id primitive.ObjectID, now, since time.Time) error {
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "$or": bson.A{
+			bson.M{"last_used_at": bson.M{"$exists": false}},
+			bson.M{"last_used_at": bson.M{"$lt": since}},
+		}},
+		bson.M{"$set": bson.M{"last_used_at": now}},
+	)
+	return err
+}
+
+func (r *mongoAPIKeyRepository) DeleteOwned(ctx context.Context, id, userID primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoAPIKeyRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return deleteByUser(ctx, r.collection, userID)
+}
+
+type mongoLoginAttemptRepository struct {
+	attempts *mongo.Collection
+	lockouts *mongo.Collection
+}
+
+// NewMongoLoginAttemptRepository counts failures in attempts and records
+// lockouts in lockouts
+func NewMongoLoginAttemptRepository(attempts, lockouts *mongo.Collection) LoginAttemptRepository {
+	return &mongoLoginAttemptRepository{attempts: attempts, lockouts: lockouts}
+}
+
+func (r *mongoLoginAttemptRepository) FindLocked(ctx context.Context, now time.Time, keys ...string) ([]models.LoginAttempt, error) {
+	cursor, err := r.attempts.Find(ctx, bson.M{
+		"_id":          bson.M{"$in": keys},
+		"locked_until": bson.M{"$gt": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := []models.LoginAttempt{}
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+func (r *mongoLoginAttemptRepository) RecordFailure(ctx context.Context, key string, now time.Time, window, retention time.Duration) (models.LoginAttempt, error) {
+	// Restart the count when the previous failure fell outside the window
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$last_failure_at", now.Add(-window)}},
+				bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+				1,
+			}},
+			"last_failure_at": now,
+			"expires_at":      now.Add(retention),
+		}}},
+	}
+
+	var attempt models.LoginAttempt
+	err := r.attempts.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": key},
+		update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempt)
+	return attempt, err
+}
+
+func (r *mongoLoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := r.attempts.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"locked_until": until}})
+	return err
+}
+
+func (r *mongoLoginAttemptRepository) Clear(ctx context.Context, key string) error {
+	_, err := r.attempts.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+func (r *mongoLoginAttemptRepository) InsertLockout(ctx context.Context, lockout models.LoginLockout) error {
+	_, err := r.lockouts.InsertOne(ctx, lockout)
+	return err
+}
+
+type mongoOIDCLoginRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoOIDCLoginRepository stores pending external sign-ins in collection
+func NewMongoOIDCLoginRepository(collection *mongo.Collection) OIDCLoginRepository {
+	return &mongoOIDCLoginRepository{collection: collection}
+}
+
+func (r *mongoOIDCLoginRepository) Insert(ctx context.Context, login models.OIDCLogin) error {
+	_, err := r.collection.InsertOne(ctx, login)
+	return err
+}
+
+func (r *mongoOIDCLoginRepository) Consume(ctx context.Context, stateHash string, now time.Time) (models.OIDCLogin, error) {
+	var login models.OIDCLogin
+	err := r.collection.FindOneAndDelete(ctx, bson.M{
+		"state_hash": stateHash,
+		"expires_at": bson.M{"$gt": now},
+	}).Decode(&login)
+	return login, notFound(err)
+}
+
+type mongoAuditLog struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAuditLog appends audit events to collection
+func NewMongoAuditLog(collection *mongo.Collection) AuditLog {
+	return &mongoAuditLog{collection: collection}
+}
+
+func (l *mongoAuditLog) Insert(ctx context.Context, event models.AuditEvent) error {
+	_, err := l.collection.InsertOne(ctx, event)
+	return err
+}
+
+func (l *mongoAuditLog) List(ctx context.Context, query AuditQuery, page, limit int) ([]models.AuditEvent, int64, error) {
+	filter := auditFilter(query)
+
+	total, err := l.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := l.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events := []models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+func auditFilter(q AuditQuery) bson.M {
+	filter := bson.M{}
+	if q.Involving != nil {
+		filter["$or"] = bson.A{
+			bson.M{"user_id": *q.Involving},
+			bson.M{"actor_id": *q.Involving},
+		}
+	}
+	for key, value := range map[string]string{
+		"action":      q.Action,
+		"target_type": q.TargetType,
+		"ip":          q.IP,
+		"request_id":  q.RequestID,
+	} {
+		if value != "" {
+			filter[key] = value
+		}
+	}
+	for key, value := range map[string]*primitive.ObjectID{
+		"user_id":   q.UserID,
+		"actor_id":  q.ActorID,
+		"target_id": q.TargetID,
+	} {
+		if value != nil {
+			filter[key] = *value
+		}
+	}
+
+	createdAt := bson.M{}
+	if q.From != nil {
+		createdAt["$gte"] = *q.From
+	}
+	if q.To != nil {
+		createdAt["$lte"] = *q.To
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+
+	return filter
+}
+
+func deleteByUser(ctx context.Context, collection *mongo.Collection, userID primitive.ObjectID) (int64, error) {
+	result, err := collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func notFound(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+func duplicate(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMatchConditionsKeepsEveryCondition(t *testing.T) {
+	got := matchConditions(bson.M{}, []Condition{
+		{Field: "book_name", Op: OpEq, Value: "Dune"},
+		{Field: "book_name", Op: OpNe, Value: "Emma"},
+		{Field: "book_name", Op: OpEq, Value: "Nope"},
+	})
+	want := bson.M{
+		"book_name": bson.M{"$eq": "Dune", "$ne": "Emma"},
+		"$and":      bson.A{bson.M{"book_name": bson.M{"$eq": "Nope"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("filter = %v, want %v", got, want)
+	}
+}
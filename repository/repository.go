@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kashyapprajapat/collecthub_api/models"
+)
+
+var (
+	ErrNotFound  = errors.New("document not found")
+	ErrDuplicate = errors.New("duplicate key")
+	// ErrVersionConflict means the document exists but no longer has the
+	// version the change was based on
+	ErrVersionConflict = errors.New("document version changed")
+)
+
+// AnyVersion lets DeleteOwned remove a document whatever its version
+const AnyVersion int64 = -1
+
+// CollectionNames are the user-owned collections served through Repository
+var CollectionNames = []string{"books", "movies", "pets", "quotes", "recipes", "travels"}
+
+// TextField is a field covered by a collection's text index
+type TextField struct {
+	Name   string // BSON name
+	Weight int32  // Importance of a match in the relevance score
+}
+
+// TextFields are the descriptive fields searched in each collection, the
+// one naming the item first
+var TextFields = map[string][]TextField{
+	"books":   {{"book_name", 3}, {"author", 2}, {"reason", 1}},
+	"movies":  {{"title", 3}, {"reason", 1}},
+	"pets":    {{"name", 3}, {"reason", 1}},
+	"quotes":  {{"quote", 2}, {"author", 2}},
+	"recipes": {{"name", 3}, {"ingredients", 1}, {"reason", 1}},
+	"travels": {{"place_name", 3}, {"reason", 1}},
+}
+
+// Repository stores documents of type T that belong to a user. T must have
+// "_id", "user_id" and "version" BSON fields. Documents owned by someone else
+// behave as if they didn't exist.
+type Repository[T any] interface {
+	Insert(ctx context.Context, doc T) error
+	// List returns one page of the owner's documents in the query's order
+	List(ctx context.Context, ownerID primitive.ObjectID, query ListQuery) (Page[T], error)
+	FindOwned(ctx context.Context, id, ownerID primitive.ObjectID) (T, error)
+	// ReplaceOwned stores doc in place of the document with the given ID,
+	// provided it is still at version
+	ReplaceOwned(ctx context.Context, id, ownerID primitive.ObjectID, version int64, doc T) error
+	// DeleteOwned removes the document at version, or AnyVersion, and
+	// returns it
+	DeleteOwned(ctx context.Context, id, ownerID primitive.ObjectID, version int64) (T, error)
+	// Search pages through the owner's documents matching a text query
+	// across the collection's TextFields, most relevant first
+	Search(ctx context.Context, ownerID primitive.ObjectID, query string, page, limit int) ([]Scored[T], int64, error)
+	// DeleteByOwner removes every document of the owner and reports how many
+	DeleteByOwner(ctx context.Context, ownerID primitive.ObjectID) (int64, error)
+}
+
+// Scored is a search result with its relevance
+type Scored[T any] struct {
+	Doc   T
+	Score float64
+}
+
+// ListQuery selects one page of a user's documents
+type ListQuery struct {
+	Filter     []Condition // Documents must meet every condition
+	Sort       string      // BSON field to order by, "_id" when empty. Ties are broken by _id.
+	Descending bool        // Order by Sort, then _id, from the highest value down
+	After      *Cursor     // Only return documents past this position
+	Limit      int
+	Count      bool     // Also count every document matching Filter
+	Fields     []string // BSON fields to load, all of them when empty. Stores may load more.
+}
+
+// Comparison operators of a Condition
+const (
+	OpEq       = "eq"
+	OpNe       = "ne"
+	OpGt       = "gt"
+	OpGte      = "gte"
+	OpLt       = "lt"
+	OpLte      = "lte"
+	OpIn       = "in"       // Value is a []interface{} of candidates
+	OpContains = "contains" // Case-insensitive substring of a string field
+)
+
+// Condition compares the BSON field Field of a document to Value, which
+// must have the Go type of the field
+type Condition struct {
+	Field string
+	Op    string
+	Value interface{}
+}
+
+// Cursor is the position of a document in a listing: its value of the sort
+// field and its ID. Value must have the Go type of the sort field.
+type Cursor struct {
+	Value interface{}
+	ID    primitive.ObjectID
+}
+
+// Page is one page of a listing
+type Page[T any] struct {
+	Items []T
+	Next  *Cursor // Position of the last item, nil when no documents follow
+	Total int64   // Only set when the query asked for a count
+}
+
+// UserRepository stores accounts. Emails are compared case-insensitively.
+type UserRepository interface {
+	FindByID(ctx context.Context, id primitive.ObjectID) (models.User, error)
+	FindByEmail(ctx context.Context, email string) (models.User, error)
+	// FindByExternalIdentity finds the account linked to a subject at an
+	// identity provider
+	FindByExternalIdentity(ctx context.Context, issuer, subject string) (models.User, error)
+	Insert(ctx context.Context, user models.User) error
+	// Update sets the given BSON fields, removing those set to nil, and
+	// returns the user as it was before the update
+	Update(ctx context.Context, id primitive.ObjectID, set map[string]interface{}) (models.User, error)
+	// ReplacePassword stores a new password hash, provided the account still
+	// has oldHash. Returns ErrNotFound when it doesn't.
+	ReplacePassword(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error
+	// MarkVerified verifies the account's email, provided it is still email.
+	// Returns ErrNotFound when it isn't.
+	MarkVerified(ctx context.Context, id primitive.ObjectID, email string) error
+	// LinkExternalIdentity adds an identity to the account and returns the
+	// updated account. Returns ErrDuplicate when the identity already
+	// belongs to an account.
+	LinkExternalIdentity(ctx context.Context, id primitive.ObjectID, identity models.ExternalIdentity) (models.User, error)
+	// AdvanceTOTPStep records step as the last accepted TOTP time step and
+	// reports false when it isn't later than the one already recorded
+	AdvanceTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error)
+	// UseRecoveryCode removes a recovery code hash and reports false when
+	// the account doesn't have it
+	UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) (bool, error)
+	// List pages through users ordered by ID, optionally matching query
+	// against name and email
+	List(ctx context.Context, query string, page, limit int) ([]models.User, int64, error)
+	Delete(ctx context.Context, id primitive.ObjectID) (int64, error)
+}
+
+// SessionRepository manages the refresh token sessions of users
+type SessionRepository interface {
+	Insert(ctx context.Context, session models.Session) error
+	// Claim marks the unused, unrevoked and unexpired session with the token
+	// hash as used and returns it. Returns ErrNotFound when there is none.
+	Claim(ctx context.Context, tokenHash string, now time.Time) (models.Session, error)
+	FindByToken(ctx context.Context, tokenHash string) (models.Session, error)
+	// FamilyActive reports whether one login still has a session that is
+	// neither revoked nor expired
+	FamilyActive(ctx context.Context, userID, familyID primitive.ObjectID, now time.Time) (bool, error)
+	// RevokeFamily revokes every session of one login and reports how many
+	RevokeFamily(ctx context.Context, userID, familyID primitive.ObjectID) (int64, error)
+	// RevokeAll revokes every session the user holds and reports how many
+	RevokeAll(ctx context.Context, userID primitive.ObjectID) (int64, error)
+	// RevokeOthers revokes every session the user holds outside one login
+	// and reports how many
+	RevokeOthers(ctx context.Context, userID, keepFamilyID primitive.ObjectID) (int64, error)
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+}
+
+// PasswordResetRepository stores password reset tokens
+type PasswordResetRepository interface {
+	Insert(ctx context.Context, reset models.PasswordReset) error
+	// Consume marks the unused, unexpired reset with the token hash as used
+	// and returns it. Returns ErrNotFound when there is none.
+	Consume(ctx context.Context, tokenHash string, now time.Time) (models.PasswordReset, error)
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+}
+
+// EmailVerificationRepository stores email verification tokens
+type EmailVerificationRepository interface {
+	Insert(ctx context.Context, verification models.EmailVerification) error
+	// Consume deletes the unexpired verification with the token hash and
+	// returns it. Returns ErrNotFound when there is none.
+	Consume(ctx context.Context, tokenHash string, now time.Time) (models.EmailVerification, error)
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+}
+
+// APIKeyRepository stores the API keys of users
+type APIKeyRepository interface {
+	Insert(ctx context.Context, key models.APIKey) error
+	CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+	// ListByUser returns the user's keys, newest first
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error)
+	// FindActive returns the unexpired key with the hash
+	FindActive(ctx context.Context, keyHash string, now time.Time) (models.APIKey, error)
+	// MarkUsed sets the key's last use to now, unless it was already used
+	// after since
+	MarkUsed(ctx context.Context, id primitive.ObjectID, now, since time.Time) error
+	DeleteOwned(ctx context.Context, id, userID primitive.ObjectID) error
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+}
+
+// LoginAttemptRepository tracks failed logins per email and per IP
+type LoginAttemptRepository interface {
+	// FindLocked returns the attempts among keys that are locked past now
+	FindLocked(ctx context.Context, now time.Time, keys ...string) ([]models.LoginAttempt, error)
+	// RecordFailure counts a failure against key at now, restarting the
+	// count when the previous failure is older than window, and returns the
+	// updated attempt. The record expires after retention.
+	RecordFailure(ctx context.Context, key string, now time.Time, window, retention time.Duration) (models.LoginAttempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Clear(ctx context.Context, key string) error
+	// InsertLockout records that a key got locked
+	InsertLockout(ctx context.Context, lockout models.LoginLockout) error
+}
+
+// OIDCLoginRepository stores external sign-ins waiting for the provider's
+// callback
+type OIDCLoginRepository interface {
+	Insert(ctx context.Context, login models.OIDCLogin) error
+	// Consume deletes the unexpired login with the state hash and returns
+	// it. Returns ErrNotFound when there is none.
+	Consume(ctx context.Context, stateHash string, now time.Time) (models.OIDCLogin, error)
+}
+
+// AuditQuery narrows an audit log listing. Zero fields don't filter.
+type AuditQuery struct {
+	Involving  *primitive.ObjectID // Events where the user is the subject or the actor
+	Action     string
+	UserID     *primitive.ObjectID
+	ActorID    *primitive.ObjectID
+	TargetType string
+	TargetID   *primitive.ObjectID
+	IP         string
+	RequestID  string
+	From       *time.Time
+	To         *time.Time
+}
+
+// AuditLog is the append-only store of audit events
+type AuditLog interface {
+	Insert(ctx context.Context, event models.AuditEvent) error
+	// List pages through matching events, newest first
+	List(ctx context.Context, query AuditQuery, page, limit int) ([]models.AuditEvent, int64, error)
+}
+
+// Store bundles every repository the handlers depend on
+type Store struct {
+	Books              Repository[models.Book]
+	Movies             Repository[models.Movie]
+	Pets               Repository[models.Pet]
+	Quotes             Repository[models.Quote]
+	Recipes            Repository[models.Recipe]
+	Travels            Repository[models.TravelBuddy]
+	Users              UserRepository
+	Sessions           SessionRepository
+	PasswordResets     PasswordResetRepository
+	EmailVerifications EmailVerificationRepository
+	APIKeys            APIKeyRepository
+	LoginAttempts      LoginAttemptRepository
+	OIDCLogins         OIDCLoginRepository
+	Audit              AuditLog
+
+	// transact runs fn atomically where the backing database can. Nil runs
+	// fn directly.
+	transact func(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// DeleteUser removes the user and every document they own, reporting how
+// many were removed from each collection. The audit log is left alone.
+func (s *Store) DeleteUser(ctx context.Context, userID primitive.ObjectID) (map[string]int64, error) {
+	owned := map[string]func(context.Context, primitive.ObjectID) (int64, error){
+		"books":               s.Books.DeleteByOwner,
+		"movies":              s.Movies.DeleteByOwner,
+		"pets":                s.Pets.DeleteByOwner,
+		"quotes":              s.Quotes.DeleteByOwner,
+		"recipes":             s.Recipes.DeleteByOwner,
+		"travels":             s.Travels.DeleteByOwner,
+		"sessions":            s.Sessions.DeleteByUser,
+		"password_resets":     s.PasswordResets.DeleteByUser,
+		"email_verifications": s.EmailVerifications.DeleteByUser,
+		"api_keys":            s.APIKeys.DeleteByUser,
+	}
+
+	var deleted map[string]int64
+	run := func(ctx context.Context) error {
+		// Filled afresh on every attempt, as transactions may be retried
+		deleted = map[string]int64{}
+		for name, deleteOwned := range owned {
+			n, err := deleteOwned(ctx, userID)
+			if err != nil {
+				return err
+			}
+			deleted[name] = n
+		}
+
+		// The user goes last so a failed attempt without a transaction can
+		// simply be retried
+		n, err := s.Users.Delete(ctx, userID)
+		if err != nil {
+			return err
+		}
+		deleted["users"] = n
+		return nil
+	}
+
+	var err error
+	if s.transact != nil {
+		err = s.transact(ctx, run)
+	} else {
+		err = run(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
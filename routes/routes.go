@@ -7,18 +7,22 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/kashyapprajapat/collecthub_api/controllers"
+	"github.com/kashyapprajapat/collecthub_api/mailer"
+	"github.com/kashyapprajapat/collecthub_api/middleware"
+	"github.com/kashyapprajapat/collecthub_api/models"
+	"github.com/kashyapprajapat/collecthub_api/repository"
+	"github.com/kashyapprajapat/collecthub_api/sso"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func SetupRoutes(app *fiber.App, db *mongo.Database) {
+// SetupRoutes serves the home page and the API from db. It fails when the
+// database can't be prepared for the API.
+func SetupRoutes(app *fiber.App, db *mongo.Database, mail mailer.Mailer, provider *sso.Provider) error {
 	// Initialize Controllers
-	controllers.InitUserController(db)
-	controllers.InitBookController(db)
-	controllers.InitRecipeController(db)
-	controllers.InitMovieController(db)
-	controllers.InitQuoteController(db)
-	controllers.InitPetController(db)
-	controllers.InitTravelController(db)
+	store, err := repository.NewMongoStore(db)
+	if err != nil {
+		return err
+	}
 
 	// Home Route
 	app.Get("/", func(c *fiber.Ctx) error {
@@ -861,57 +865,78 @@ func SetupRoutes(app *fiber.App, db *mongo.Database) {
 		return c.Type("html").SendString(htmlContent)
 	})
 
+	RegisterAPI(app, store, mail, provider)
+	return nil
+}
+
+// RegisterAPI mounts every /api route, backed by store
+func RegisterAPI(app *fiber.App, store *repository.Store, mail mailer.Mailer, provider *sso.Provider) {
+	accounts := controllers.NewAuthHandler(store, mail, provider)
+	apiKeys := controllers.NewAPIKeyHandler(store.APIKeys, store.Users)
+	profile := controllers.NewProfileHandler(store, mail)
+	adminUsers := controllers.NewAdminHandler(store.Users, store.Sessions, store.Audit)
+	audit := controllers.NewAuditHandler(store.Audit)
+
 	api := app.Group("/api")
 
-	// User Routes
-	api.Post("/users", controllers.CreateUser)
-	api.Get("/users", controllers.GetUsers)
-	api.Post("/users/login", controllers.LoginUser)
+	// Public User Routes
+	api.Post("/users", accounts.CreateUser)
+	api.Post("/users/login", accounts.LoginUser)
+	api.Post("/users/login/2fa", accounts.LoginTwoFactor)
+	api.Post("/users/token/refresh", accounts.RefreshAccessToken)
+	api.Post("/users/password/forgot", accounts.ForgotPassword)
+	api.Post("/users/password/reset", accounts.ResetPassword)
+	api.Post("/users/verify-email", accounts.VerifyEmail)
 
-	// Book Routes
-	api.Post("/books", controllers.CreateBook)
-	api.Get("/books/user/:userId", controllers.GetBooksByUser)
-	api.Get("/books/:id", controllers.GetBookByID)
-	api.Put("/books/:id", controllers.UpdateBook)
-	api.Delete("/books/:id", controllers.DeleteBook)
+	// Sign in with an external identity provider, when one is configured
+	if provider != nil {
+		api.Get("/users/oidc/login", accounts.OIDCLogin)
+		api.Get("/users/oidc/callback", accounts.OIDCCallback)
+	}
 
-	// Recipe Routes
-	api.Post("/recipes", controllers.CreateRecipe)
-	api.Get("/recipes/user/:userId", controllers.GetRecipesByUser)
-	api.Get("/recipes/:id", controllers.GetRecipeByID)
-	api.Put("/recipes/:id", controllers.UpdateRecipe)
-	api.Delete("/recipes/:id", controllers.DeleteRecipe)
+	// 🔐 Every /api route registered below requires an access token or API key
+	api.Use(middleware.RequireAuth(accounts.SessionActive, apiKeys.ResolveAPIKey))
 
-	// Movie Routes
-	api.Post("/movies", controllers.CreateMovie)
-	api.Get("/movies/user/:userId", controllers.GetMoviesByUser)
-	api.Get("/movies/:id", controllers.GetMovieByID)
-	api.Put("/movies/:id", controllers.UpdateMovie)
-	api.Delete("/movies/:id", controllers.DeleteMovie)
+	// User Routes (account management needs a signed-in session, not an API key)
+	users := api.Group("/users", middleware.RejectAPIKeys())
+	users.Get("/", middleware.RequireRole(adminUsers.CurrentRole, models.RoleAdmin), adminUsers.GetUsers)
+	users.Post("/logout", accounts.Logout)
+	users.Post("/logout-all", accounts.LogoutAll)
+	users.Post("/verify-email/resend", accounts.ResendVerificationEmail)
+	users.Get("/me", profile.GetMe)
+	users.Get("/me/activity", audit.GetMyActivity)
+	users.Patch("/me", profile.UpdateMe)
+	users.Delete("/me", profile.DeleteMe)
+	users.Post("/me/password", profile.ChangePassword)
+	users.Post("/me/2fa/setup", accounts.SetupTwoFactor)
+	users.Post("/me/2fa/verify", accounts.VerifyTwoFactor)
+	users.Post("/me/2fa/disable", accounts.DisableTwoFactor)
+	users.Post("/me/apikeys", apiKeys.CreateAPIKey)
+	users.Get("/me/apikeys", apiKeys.GetAPIKeys)
+	users.Delete("/me/apikeys/:id", apiKeys.DeleteAPIKey)
 
-	// Quote Routes
-	api.Post("/quotes", controllers.CreateQuote)
-	api.Get("/quotes/user/:userId", controllers.GetQuotesByUser)
-	api.Get("/quotes/:id", controllers.GetQuoteByID)
-	api.Put("/quotes/:id", controllers.UpdateQuote)
-	api.Delete("/quotes/:id", controllers.DeleteQuote)
+	// 🛡️ Admin Routes
+	admin := api.Group("/admin", middleware.RejectAPIKeys(), middleware.RequireRole(adminUsers.CurrentRole, models.RoleAdmin))
+	admin.Get("/users", adminUsers.GetUsers)
+	admin.Patch("/users/:id/status", adminUsers.SetUserStatus)
+	admin.Patch("/users/:id/role", adminUsers.SetUserRole)
+	admin.Get("/audit-events", audit.GetAuditEvents)
 
-	// Pet Routes
-	api.Post("/pets", controllers.CreatePet)
-	api.Get("/pets/user/:userId", controllers.GetPetsByUser)
-	api.Get("/pets/:id", controllers.GetPetByID)
-	api.Put("/pets/:id", controllers.UpdatePet)
-	api.Delete("/pets/:id", controllers.DeletePet)
+	// Collection Routes: POST /<name>, GET /<name>/user/:userId,
+	// GET /<name>/search and GET, PUT, PATCH, DELETE /<name>/:id for books,
+	// recipes, movies, quotes, pets and travels
+	collections := controllers.NewCollections(store)
+	for _, resource := range collections {
+		resource.Register(api)
+	}
 
-	// Travel Routes
-	api.Post("/travels", controllers.CreateTravel)
-	api.Get("/travels/user/:userId", controllers.GetTravelsByUser)
-	api.Get("/travels/:id", controllers.GetTravelByID)
-	api.Put("/travels/:id", controllers.UpdateTravel)
-	api.Delete("/travels/:id", controllers.DeleteTravel)
+	// Views across every collection, limited to the ones an API key can read
+	library := controllers.NewLibraryHandler(collections)
+	api.Get("/me/search", library.Search)
+	api.Get("/me/feed", library.Feed)
 
 	// 🤖 AI Personality Analysis Route
-	api.Post("/aipersonality/analysis", controllers.GetAIPersonalityAnalysis(db))
+	api.Post("/aipersonality/analysis", middleware.RequireScope("ai:analyze"), middleware.RequireVerifiedEmail(middleware.FeatureAI), controllers.GetAIPersonalityAnalysis(store))
 }
 
 // Helper functions
@@ -0,0 +1,152 @@
+// Package search matches text against search queries the way MongoDB text
+// search roughly does: case-insensitive words with light English stemming,
+// where any word may match and "-word" excludes a document. It scores
+// documents in the in-memory store and highlights matches in results.
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed search query
+type Query struct {
+	terms    []string // Stems of the words to look for
+	excluded []string // Stems of the words documents must not contain
+}
+
+// Parse splits a query into words. Quotes are ignored, so a phrase matches
+// like its words do.
+func Parse(q string) Query {
+	var query Query
+	for _, field := range strings.Fields(q) {
+		negated := strings.HasPrefix(field, "-")
+		for _, w := range words(field) {
+			if negated {
+				query.excluded = append(query.excluded, w.stem)
+			} else {
+				query.terms = append(query.terms, w.stem)
+			}
+		}
+	}
+	return query
+}
+
+// Empty reports whether the query has no words to look for
+func (q Query) Empty() bool {
+	return len(q.terms) == 0
+}
+
+// Count returns how many words of text match the query, and whether text
+// contains an excluded word
+func (q Query) Count(text string) (matches int, excluded bool) {
+	for _, w := range words(text) {
+		if contains(q.excluded, w.stem) {
+			return 0, true
+		}
+		if contains(q.terms, w.stem) {
+			matches++
+		}
+	}
+	return matches, false
+}
+
+// Snippet returns about width bytes of text around its first match, HTML
+// escaped, with every matching word wrapped in <mark></mark> and "…" where
+// text was cut. It returns "" when nothing in text matches.
+func (q Query) Snippet(text string, width int) string {
+	ws := words(text)
+	first := -1
+	for i, w := range ws {
+		if contains(q.terms, w.stem) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	start, end := 0, len(text)
+	if len(text) > width {
+		// Keep up to a third of the snippet as context before the match
+		start = ws[first].start
+		for i := first; i >= 0 && ws[first].end-ws[i].start <= width/3; i-- {
+			start = ws[i].start
+		}
+		end = ws[first].end
+		for _, w := range ws[first:] {
+			if w.end-start > width {
+				break
+			}
+			end = w.end
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, w := range ws {
+		if w.start < start || w.end > end || !contains(q.terms, w.stem) {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:w.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[w.start:w.end]))
+		b.WriteString("</mark>")
+		pos = w.end
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+type word struct {
+	start, end int // Byte offsets in the text
+	stem       string
+}
+
+// words splits text into runs of letters and digits
+func words(text string) []word {
+	var ws []word
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if inWord && start < 0 {
+			start = i
+		} else if !inWord && start >= 0 {
+			ws = append(ws, word{start, i, stem(text[start:i])})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		ws = append(ws, word{start, len(text), stem(text[start:])})
+	}
+	return ws
+}
+
+// stem lowercases a word and strips common English suffixes, so "recipes"
+// and "recipe" or "dreamed" and "dreaming" match each other
+func stem(w string) string {
+	w = strings.ToLower(w)
+	for _, suffix := range []string{"ing", "ed", "es", "s", "e"} {
+		if trimmed, ok := strings.CutSuffix(w, suffix); ok && len(trimmed) >= 3 {
+			return trimmed
+		}
+	}
+	return w
+}
+
+func contains(stems []string, s string) bool {
+	for _, v := range stems {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
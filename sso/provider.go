@@ -0,0 +1,183 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Config describes an OpenID Connect identity provider
+type Config struct {
+	Name         string // Shown to users, e.g. "Google"
+	IssuerURL    string // Discovery is done against <IssuerURL>/.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // Must point at /api/users/oidc/callback
+	Scopes       []string
+}
+
+// Identity is what the provider asserts about the person who signed in
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider runs the authorization code flow with PKCE against one issuer
+type Provider struct {
+	name     string
+	oauth    oauth2.Config
+	oidc     *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+// ConfigFromEnv reads the provider settings. It reports false when
+// OIDC_ISSUER_URL is not set, which leaves external sign-in switched off.
+func ConfigFromEnv() (Config, bool, error) {
+	cfg := Config{
+		Name:         os.Getenv("OIDC_PROVIDER_NAME"),
+		IssuerURL:    os.Getenv("OIDC_ISSUER_URL"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(strings.ReplaceAll(os.Getenv("OIDC_SCOPES"), ",", " ")),
+	}
+	if cfg.IssuerURL == "" {
+		return cfg, false, nil
+	}
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return cfg, false, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER_URL is set")
+	}
+	return cfg, true, nil
+}
+
+// FromEnv builds the provider configured by environment variables, or
+// returns nil when external sign-in is not configured
+func FromEnv(ctx context.Context) (*Provider, error) {
+	cfg, ok, err := ConfigFromEnv()
+	if err != nil || !ok {
+		return nil, err
+	}
+	return New(ctx, cfg)
+}
+
+// New discovers the issuer's endpoints and signing keys. Use
+// oidc.ClientContext on ctx to supply a custom HTTP client.
+func New(ctx context.Context, cfg Config) (*Provider, error) {
+	discovered, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("discovering %s: %v", cfg.IssuerURL, err)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	// The openid scope is what makes this an OpenID Connect request
+	hasOpenID := false
+	for _, scope := range scopes {
+		if scope == oidc.ScopeOpenID {
+			hasOpenID = true
+		}
+	}
+	if !hasOpenID {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = cfg.IssuerURL
+	}
+
+	return &Provider{
+		name: name,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     discovered.Endpoint(),
+			Scopes:       scopes,
+		},
+		oidc:     discovered,
+		verifier: discovered.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// Name is the display name of the provider
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// NewVerifier returns a random PKCE code verifier
+func NewVerifier() string {
+	return oauth2.GenerateVerifier()
+}
+
+// AuthCodeURL is where the browser is sent to sign in. The S256 challenge
+// of verifier is sent along so only the holder of verifier can redeem the code.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange redeems an authorization code, verifies the returned ID token and
+// its nonce, and returns the identity it asserts
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %v", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id_token: %v", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified *bool  `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("decoding id_token claims: %v", err)
+	}
+
+	// Some providers only put the email in the userinfo response
+	if claims.Email == "" {
+		info, err := p.oidc.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err == nil && info.Subject == idToken.Subject {
+			claims.Email = info.Email
+			claims.EmailVerified = &info.EmailVerified
+			if claims.Name == "" {
+				var profile struct {
+					Name string `json:"name"`
+				}
+				if info.Claims(&profile) == nil {
+					claims.Name = profile.Name
+				}
+			}
+		}
+	}
+
+	return &Identity{
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified != nil && *claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
@@ -0,0 +1,184 @@
+// Package validation checks request bodies against the rules declared in
+// `validate` struct tags, e.g.
+//
+//	Title string `json:"title" validate:"required,max=200"`
+//
+// Supported rules:
+//
+//	required     the field must not be empty (blank strings count as empty)
+//	max=N        strings may have at most N characters
+//	oneof=a b c  non-empty strings must be one of the listed values
+//	notfuture    times must not be after the moment of validation
+//
+// Pointer fields are optional, as in partial updates: nil means the field
+// wasn't sent and is skipped, otherwise the rules apply to what it points to.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Error codes, stable for clients to branch on
+const (
+	CodeRequired   = "required"
+	CodeTooLong    = "too_long"
+	CodeNotAllowed = "not_allowed"
+	CodeFutureDate = "future_date"
+	CodeInvalid    = "invalid"
+)
+
+// Error describes one invalid field, named as in the JSON body
+type Error struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors lists every invalid field of a request
+type Errors []Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add appends an error found outside the tag rules, such as a password
+// policy violation
+func (e *Errors) Add(field, code, message string) {
+	*e = append(*e, Error{Field: field, Code: code, Message: message})
+}
+
+// Struct checks every field of the struct v points to
+func Struct(v interface{}) Errors {
+	value := reflect.Indirect(reflect.ValueOf(v))
+
+	var errs Errors
+	for _, field := range rulesFor(value.Type()) {
+		fv := value.FieldByIndex(field.index)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if isEmpty(fv) {
+			if hasRule(field.rules, "required") {
+				errs.Add(field.name, CodeRequired, field.name+" is required")
+			}
+			continue
+		}
+		for _, r := range field.rules {
+			if err, failed := apply(r, field.name, fv); failed {
+				errs = append(errs, err)
+				break
+			}
+		}
+	}
+	return errs
+}
+
+type fieldRules struct {
+	index []int
+	name  string
+	rules []rule
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+var rulesCache sync.Map // reflect.Type -> []fieldRules
+
+func apply(r rule, name string, v reflect.Value) (Error, bool) {
+	switch r.name {
+	case "max":
+		limit, _ := strconv.Atoi(r.param)
+		if v.Kind() == reflect.String && utf8.RuneCountInString(v.String()) > limit {
+			return Error{name, CodeTooLong, fmt.Sprintf("%s must be at most %d characters", name, limit)}, true
+		}
+	case "oneof":
+		allowed := strings.Fields(r.param)
+		if v.Kind() == reflect.String && !contains(allowed, v.String()) {
+			return Error{name, CodeNotAllowed, name + " must be one of: " + strings.Join(allowed, ", ")}, true
+		}
+	case "notfuture":
+		if t, ok := v.Interface().(time.Time); ok && t.After(time.Now()) {
+			return Error{name, CodeFutureDate, name + " cannot be in the future"}, true
+		}
+	}
+	return Error{}, false
+}
+
+func rulesFor(t reflect.Type) []fieldRules {
+	if cached, ok := rulesCache.Load(t); ok {
+		return cached.([]fieldRules)
+	}
+
+	var fields []fieldRules
+	for _, f := range reflect.VisibleFields(t) {
+		tag, ok := f.Tag.Lookup("validate")
+		if !ok || !f.IsExported() {
+			continue
+		}
+
+		field := fieldRules{index: f.Index, name: JSONName(f)}
+		for _, part := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch name {
+			case "required", "max", "oneof", "notfuture":
+			default:
+				panic(fmt.Sprintf("validation: unknown rule %q on %s.%s", name, t.Name(), f.Name))
+			}
+			field.rules = append(field.rules, rule{name: name, param: param})
+		}
+		fields = append(fields, field)
+	}
+
+	rulesCache.Store(t, fields)
+	return fields
+}
+
+// JSONName is the name clients use for a struct field, which is also the
+// name its errors are reported under
+func JSONName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
+
+func isEmpty(v reflect.Value) bool {
+	if v.Kind() == reflect.String {
+		return strings.TrimSpace(v.String()) == ""
+	}
+	return v.IsZero()
+}
+
+func hasRule(rules []rule, name string) bool {
+	for _, r := range rules {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}